@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/format"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/vm"
+)
+
+// inlineFilename names source passed with -e in error messages.
+const inlineFilename = "<-e>"
+
+// commands are the subcommands accepted as the first argument. Without one,
+// tree behaves like "tree run" and starts the REPL when given no source.
+var commands = []struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}{
+	{"run", "run a script (the default)", runCmd},
+	{"tokens", "print the tokens scanned from a script", tokensCmd},
+	{"ast", "print the syntax tree parsed from a script", astCmd},
+	{"compile", "compile a script to a bytecode file that runs without the source", compileCmd},
+	{"disasm", "print the bytecode compiled from a script", disasmCmd},
+	{"fmt", "format scripts in the canonical style", fmtCmd},
+}
+
+// exitUnformatted is returned by "fmt --check" when a script is not
+// formatted.
+const exitUnformatted = 1
+
+// runCommand dispatches to the subcommand named by args[0], or runs args as
+// a script.
+func runCommand(args []string) int {
+	if len(args) > 0 {
+		for _, c := range commands {
+			if c.name == args[0] {
+				return c.run(args[1:])
+			}
+		}
+	}
+	if !checkDiagnosticsFormat() || !checkEngine() {
+		flag.Usage()
+		return exitUsage
+	}
+	if len(args) == 0 && *inlineSource == "" {
+		runPrompt()
+		return 0
+	}
+	return runSource(args)
+}
+
+// newFlagSet creates the flag set for a subcommand. The global flags are
+// accepted again after the command name.
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(diagnosticsFormat, "diagnostics", *diagnosticsFormat, diagnosticsUsage)
+	fs.StringVar(inlineSource, "e", *inlineSource, inlineUsage)
+	fs.StringVar(engine, "engine", *engine, engineUsage)
+	fs.BoolVar(noOpt, "no-opt", *noOpt, noOptUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tree %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses a subcommand's arguments, returning false if they are
+// invalid.
+func parseFlags(fs *flag.FlagSet, args []string) bool {
+	if err := fs.Parse(args); err != nil {
+		return false
+	}
+	if !checkDiagnosticsFormat() || !checkEngine() {
+		fs.Usage()
+		return false
+	}
+	return true
+}
+
+// readSource returns the source named by the command line: the -e flag or a
+// single script file. It returns a non-zero exit code if there is none.
+func readSource(args []string, usage func()) (filename, source string, code int) {
+	if *inlineSource != "" {
+		if len(args) > 0 {
+			usage()
+			return "", "", exitUsage
+		}
+		return inlineFilename, *inlineSource, 0
+	}
+	if len(args) != 1 {
+		usage()
+		return "", "", exitUsage
+	}
+	bytes, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return "", "", exitIOErr
+	}
+	return args[0], string(bytes), 0
+}
+
+func runCmd(args []string) int {
+	fs := newFlagSet("run", "<script>")
+	fs.BoolVar(traceExec, "trace-exec", *traceExec, traceExecUsage)
+	if !parseFlags(fs, args) {
+		return exitUsage
+	}
+	return runSource(fs.Args())
+}
+
+// runSource runs the script or -e source named by args. Inline source may be
+// a bare expression, whose value is printed.
+func runSource(args []string) int {
+	filename, source, code := readSource(args, flag.Usage)
+	if code != 0 {
+		return code
+	}
+	if strings.HasPrefix(source, vm.Magic) {
+		return runCompiled(filename, source)
+	}
+	if filename != inlineFilename {
+		return run(filename, source)
+	}
+
+	tokens, scanErrors := scanner.ScanTokens(source)
+	if len(scanErrors) > 0 {
+		reportErrors(filename, source, errors.Join(scanErrors...))
+		return exitDataErr
+	}
+	statements, echo, err := parseInput(tokens)
+	if err != nil {
+		reportErrors(filename, source, err)
+		return exitDataErr
+	}
+	if *engine == "vm" || *traceExec {
+		if echo {
+			statements[0] = &parser.PrintStmt{Expression: statements[0].(*parser.ExpressionStmt).Expression}
+		}
+		return runVM(filename, source, statements, nil)
+	}
+	return newREPL(os.Stdout).execute(filename, source, statements, echo)
+}
+
+func tokensCmd(args []string) int {
+	fs := newFlagSet("tokens", "<script>")
+	if !parseFlags(fs, args) {
+		return exitUsage
+	}
+	filename, source, code := readSource(fs.Args(), fs.Usage)
+	if code != 0 {
+		return code
+	}
+	return dumpTokens(os.Stdout, filename, source)
+}
+
+func astCmd(args []string) int {
+	fs := newFlagSet("ast", "<script>")
+	format := fs.String("format", "sexpr", "output `format`: sexpr, tree (indented) or json")
+	if !parseFlags(fs, args) {
+		return exitUsage
+	}
+	filename, source, code := readSource(fs.Args(), fs.Usage)
+	if code != 0 {
+		return code
+	}
+	switch *format {
+	case "sexpr", "tree", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown AST format %q.\n", *format)
+		fs.Usage()
+		return exitUsage
+	}
+	return dumpAST(os.Stdout, filename, source, *format)
+}
+
+func compileCmd(args []string) int {
+	fs := newFlagSet("compile", "<script>")
+	output := fs.String("o", "", "write the bytecode to `file` (default: the script name with a .loxc extension)")
+	if !parseFlags(fs, args) {
+		return exitUsage
+	}
+	filename, source, code := readSource(fs.Args(), fs.Usage)
+	if code != 0 {
+		return code
+	}
+	if *output == "" {
+		if filename == inlineFilename {
+			fs.Usage()
+			return exitUsage
+		}
+		*output = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".loxc"
+	}
+	return compileFile(filename, source, *output)
+}
+
+// compileFile compiles source to bytecode and saves it to output.
+func compileFile(filename, source, output string) int {
+	tokens, scanErrors := scanner.ScanTokens(source)
+	statements, ranges, err := parser.ParseProgramWithRanges(tokens)
+	if len(scanErrors) > 0 || err != nil {
+		reportErrors(filename, source, errors.Join(append(scanErrors, err)...))
+		return exitDataErr
+	}
+	function, ok := compileProgram(filename, source, statements, ranges)
+	if !ok {
+		return exitDataErr
+	}
+
+	var buf bytes.Buffer
+	if err := vm.Save(&buf, function); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSoftware
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIOErr
+	}
+	return 0
+}
+
+func disasmCmd(args []string) int {
+	fs := newFlagSet("disasm", "<script>")
+	if !parseFlags(fs, args) {
+		return exitUsage
+	}
+	filename, source, code := readSource(fs.Args(), fs.Usage)
+	if code != 0 {
+		return code
+	}
+	return dumpBytecode(os.Stdout, filename, source)
+}
+
+func fmtCmd(args []string) int {
+	fs := newFlagSet("fmt", "[script ...]")
+	write := fs.Bool("w", false, "write the result to each script instead of printing it")
+	check := fs.Bool("check", false, "list the scripts that are not formatted and exit with status 1 if there are any")
+	if !parseFlags(fs, args) {
+		return exitUsage
+	}
+	files := fs.Args()
+	if *inlineSource != "" && len(files) > 0 || *write && len(files) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	if *inlineSource != "" {
+		return formatSource(os.Stdout, inlineFilename, *inlineSource, *check, false)
+	}
+	if len(files) == 0 {
+		bytes, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitIOErr
+		}
+		return formatSource(os.Stdout, "<stdin>", string(bytes), *check, false)
+	}
+
+	code := 0
+	for _, filename := range files {
+		bytes, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = max(code, exitIOErr)
+			continue
+		}
+		code = max(code, formatSource(os.Stdout, filename, string(bytes), *check, *write))
+	}
+	return code
+}
+
+// formatSource formats one script. By default the result is printed; with
+// check only the name of an unformatted script is, and with write the
+// script is rewritten in place if it changed.
+func formatSource(w io.Writer, filename, source string, check, write bool) int {
+	formatted, err := format.Source(source)
+	if err != nil {
+		reportErrors(filename, source, err)
+		return exitDataErr
+	}
+
+	switch {
+	case check:
+		if formatted != source {
+			fmt.Fprintln(w, filename)
+			return exitUnformatted
+		}
+	case write:
+		if formatted != source {
+			if err := writeFile(filename, formatted); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitIOErr
+			}
+		}
+	default:
+		fmt.Fprint(w, formatted)
+	}
+	return 0
+}
+
+// writeFile replaces the contents of an existing file, keeping its mode.
+func writeFile(filename, contents string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(contents), info.Mode().Perm())
+}
+
+// dumpTokens prints every token scanned from source, one per line, with its
+// position, type, lexeme and literal value.
+func dumpTokens(w io.Writer, filename, source string) int {
+	tokens, scanErrors := scanner.ScanTokens(source)
+	for _, token := range tokens {
+		fmt.Fprintf(w, "%d:%d %s %q", token.Line, token.Column, scanner.TokenTypeNames[token.Type], token.Lexeme)
+		if token.Literal != nil {
+			fmt.Fprintf(w, " %v", token.Literal)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(scanErrors) > 0 {
+		reportErrors(filename, source, errors.Join(scanErrors...))
+		return exitDataErr
+	}
+	return 0
+}
+
+// astPrinter is implemented by parser.AstPrinter and parser.TreePrinter.
+type astPrinter interface {
+	Print(expr parser.Expr) (string, error)
+	PrintStmt(stmt parser.Stmt) (string, error)
+}
+
+// dumpAST prints the syntax tree of source in the given format. A bare
+// expression is printed on its own rather than as an expression statement.
+func dumpAST(w io.Writer, filename, source, format string) int {
+	tokens, scanErrors := scanner.ScanTokens(source)
+	if len(scanErrors) > 0 {
+		reportErrors(filename, source, errors.Join(scanErrors...))
+		return exitDataErr
+	}
+
+	var printer astPrinter = &parser.AstPrinter{}
+	switch format {
+	case "tree":
+		printer = &parser.TreePrinter{}
+	case "json":
+		printer = jsonPrinter{}
+	}
+
+	if expr, err := parser.Parse(tokens); err == nil {
+		s, err := printer.Print(expr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitSoftware
+		}
+		fmt.Fprintln(w, s)
+		return 0
+	}
+
+	statements, err := parser.ParseProgram(tokens)
+	if err != nil {
+		reportErrors(filename, source, err)
+		return exitDataErr
+	}
+	if format == "json" {
+		data, err := parser.ProgramToJSON(statements)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitSoftware
+		}
+		fmt.Fprintln(w, indentJSON(data))
+		return 0
+	}
+	for _, stmt := range statements {
+		s, err := printer.PrintStmt(stmt)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitSoftware
+		}
+		fmt.Fprintln(w, s)
+	}
+	return 0
+}
+
+// dumpBytecode prints the disassembly of the bytecode compiled from source,
+// or loaded from it if it is a compiled file: the top-level script followed
+// by every function it declares.
+func dumpBytecode(w io.Writer, filename, source string) int {
+	if strings.HasPrefix(source, vm.Magic) {
+		function, err := vm.Load(strings.NewReader(source))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			return exitDataErr
+		}
+		vm.Disassemble(w, function)
+		return 0
+	}
+
+	tokens, scanErrors := scanner.ScanTokens(source)
+	statements, ranges, err := parser.ParseProgramWithRanges(tokens)
+	if len(scanErrors) > 0 || err != nil {
+		reportErrors(filename, source, errors.Join(append(scanErrors, err)...))
+		return exitDataErr
+	}
+	function, ok := compileProgram(filename, source, statements, ranges)
+	if !ok {
+		return exitDataErr
+	}
+	vm.Disassemble(w, function)
+	return 0
+}
+
+// jsonPrinter adapts the AST JSON encoder to astPrinter.
+type jsonPrinter struct{}
+
+func (jsonPrinter) Print(expr parser.Expr) (string, error) {
+	data, err := parser.ExprToJSON(expr)
+	return indentJSON(data), err
+}
+
+func (jsonPrinter) PrintStmt(stmt parser.Stmt) (string, error) {
+	data, err := parser.ProgramToJSON([]parser.Stmt{stmt})
+	return indentJSON(data), err
+}
+
+func indentJSON(data []byte) string {
+	var b bytes.Buffer
+	if err := json.Indent(&b, data, "", "  "); err != nil {
+		return string(data)
+	}
+	return b.String()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDumpTokens(t *testing.T) {
+	var out strings.Builder
+	if code := dumpTokens(&out, "test.lox", "var s = \"hi\";\nprint s + 1.5;"); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+
+	expected := `1:1 VAR "var"
+1:5 IDENTIFIER "s"
+1:7 EQUAL "="
+1:9 STRING "\"hi\"" hi
+1:13 SEMICOLON ";"
+2:1 PRINT "print"
+2:7 IDENTIFIER "s"
+2:9 PLUS "+"
+2:11 NUMBER "1.5" 1.5
+2:14 SEMICOLON ";"
+2:15 EOF ""
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestDumpAST(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		format   string
+		expected string
+	}{
+		{"expression", "1 + 2 * 3", "sexpr", "(+ 1 (* 2 3))\n"},
+		{"statements", "var a = 1;\nprint a;", "sexpr", "(var a 1)\n(print a)\n"},
+		{"tree", "print -a;", "tree", "Print\n  Unary -\n    Variable a\n"},
+		{"json", "nil;", "json", `[
+  {
+    "node": "Expression",
+    "expression": {
+      "node": "Literal",
+      "value": null
+    }
+  }
+]
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if code := dumpAST(&out, "test.lox", tt.source, tt.format); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d", code)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestDumpBytecode(t *testing.T) {
+	var out strings.Builder
+	if code := dumpBytecode(&out, "test.lox", "var a = 1;\nprint a;"); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+
+	expected := `== <script> ==
+0000    1 OP_CONSTANT         0 '1'
+0003    | OP_DEFINE_GLOBAL    1 'a'
+0006    2 OP_GET_GLOBAL       1 'a'
+0009    | OP_PRINT
+0010    | OP_NIL
+0011    | OP_RETURN
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestDumpBytecode_NoOpt(t *testing.T) {
+	source := "print (1 + 2) * 3;"
+	tests := []struct {
+		noOpt    bool
+		expected string
+	}{
+		{false, `== <script> ==
+0000    1 OP_CONSTANT         0 '9'
+0003    | OP_PRINT
+0004    | OP_NIL
+0005    | OP_RETURN
+`},
+		{true, `== <script> ==
+0000    1 OP_CONSTANT         0 '1'
+0003    | OP_CONSTANT         1 '2'
+0006    | OP_ADD
+0007    | OP_CONSTANT         2 '3'
+0010    | OP_MULTIPLY
+0011    | OP_PRINT
+0012    | OP_NIL
+0013    | OP_RETURN
+`},
+	}
+
+	defer func(saved bool) { *noOpt = saved }(*noOpt)
+	for _, tt := range tests {
+		*noOpt = tt.noOpt
+		var out strings.Builder
+		if code := dumpBytecode(&out, "test.lox", source); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d", code)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("With noOpt=%v, expected:\n%s\nGot:\n%s", tt.noOpt, tt.expected, out.String())
+		}
+	}
+}
+
+func TestCompileFile(t *testing.T) {
+	source := "fun f(a) { return a + 1; }\nprint f(1);"
+	output := filepath.Join(t.TempDir(), "f.loxc")
+	if code := compileFile("f.lox", source, output); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The compiled file disassembles to the same bytecode as the source.
+	var fromSource, fromFile strings.Builder
+	dumpBytecode(&fromSource, "f.lox", source)
+	if code := dumpBytecode(&fromFile, output, string(data)); code != 0 {
+		t.Fatalf("Expected exit code 0 loading the compiled file, got %d", code)
+	}
+	if fromFile.String() != fromSource.String() {
+		t.Errorf("Expected:\n%s\nGot:\n%s", fromSource.String(), fromFile.String())
+	}
+}
+
+func TestFormatSource(t *testing.T) {
+	dir := t.TempDir()
+	formatted := filepath.Join(dir, "formatted.lox")
+	messy := filepath.Join(dir, "messy.lox")
+	os.WriteFile(formatted, []byte("print 1;\n"), 0o644)
+	os.WriteFile(messy, []byte("print   1 ;"), 0o644)
+
+	var out strings.Builder
+	if code := formatSource(&out, formatted, "print 1;\n", true, false); code != 0 || out.String() != "" {
+		t.Errorf("Check of a formatted script: got code %d and output %q", code, out.String())
+	}
+	if code := formatSource(&out, messy, "print   1 ;", true, false); code != exitUnformatted || out.String() != messy+"\n" {
+		t.Errorf("Check of an unformatted script: got code %d and output %q", code, out.String())
+	}
+
+	out.Reset()
+	if code := formatSource(&out, messy, "print   1 ;", false, true); code != 0 || out.String() != "" {
+		t.Errorf("Write: got code %d and output %q", code, out.String())
+	}
+	if data, _ := os.ReadFile(messy); string(data) != "print 1;\n" {
+		t.Errorf("Expected the script to be rewritten, got %q", data)
+	}
+
+	if code := formatSource(&out, messy, "print 1;\n", false, false); code != 0 || out.String() != "print 1;\n" {
+		t.Errorf("Print: got code %d and output %q", code, out.String())
+	}
+}
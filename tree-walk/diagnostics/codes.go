@@ -0,0 +1,64 @@
+package diagnostics
+
+// Code identifies a kind of diagnostic. Codes are stable: once assigned, a
+// code keeps its meaning so tools can match on it instead of the message.
+type Code string
+
+// Scanner errors.
+const (
+	UnexpectedCharacter Code = "E0001"
+	UnterminatedString  Code = "E0002"
+	UnterminatedComment Code = "E0003"
+	InvalidNumber       Code = "E0004"
+)
+
+// Parser errors.
+const (
+	ExpectedToken           Code = "E0100"
+	ExpectedExpression      Code = "E0101"
+	InvalidAssignmentTarget Code = "E0102"
+	TooManyArguments        Code = "E0103"
+	TooManyParameters       Code = "E0104"
+	TrailingTokens          Code = "E0105"
+)
+
+// Resolver errors.
+const (
+	ReadInOwnInitializer   Code = "E0200"
+	DuplicateDeclaration   Code = "E0201"
+	TopLevelReturn         Code = "E0202"
+	InitializerReturnValue Code = "E0203"
+	ThisOutsideClass       Code = "E0204"
+	SelfInheritance        Code = "E0205"
+	SuperOutsideClass      Code = "E0206"
+	SuperWithoutSuperclass Code = "E0207"
+)
+
+// Runtime errors.
+const (
+	OperandType        Code = "E0300"
+	UndefinedVariable  Code = "E0301"
+	UndefinedProperty  Code = "E0302"
+	NotCallable        Code = "E0303"
+	ArityMismatch      Code = "E0304"
+	DivisionByZero     Code = "E0305"
+	NotAnInstance      Code = "E0306"
+	SuperclassNotClass Code = "E0307"
+	StackOverflow      Code = "E0308"
+	InvalidBytecode    Code = "E0309"
+)
+
+// Bytecode compiler errors, raised when a program exceeds a limit of the
+// bytecode format.
+const (
+	TooManyConstants Code = "E0400"
+	TooManyLocals    Code = "E0401"
+	TooManyUpvalues  Code = "E0402"
+	JumpTooLarge     Code = "E0403"
+)
+
+// Optimizer errors, raised when constant folding finds an operation that
+// would always fail at runtime.
+const (
+	ConstantDivisionByZero Code = "E0500"
+)
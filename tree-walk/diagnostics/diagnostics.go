@@ -0,0 +1,72 @@
+package diagnostics
+
+import (
+	"errors"
+)
+
+// Severity is how serious a diagnostic is.
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+var severityNames = map[Severity]string{
+	Error:   "error",
+	Warning: "warning",
+	Note:    "note",
+}
+
+func (s Severity) String() string {
+	return severityNames[s]
+}
+
+// Span is a range of source text. Start and End are byte offsets, with End
+// exclusive; Line and Column are the 1-based position of Start. A span with a
+// Line but no Column covers a whole line whose offsets are not known.
+type Span struct {
+	Start  int
+	End    int
+	Line   int
+	Column int
+}
+
+// Diagnostic is a message about a range of source code.
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Span     Span
+	Message  string
+	Notes    []string
+}
+
+// Diagnoser is implemented by errors that can describe themselves as a
+// Diagnostic.
+type Diagnoser interface {
+	Diagnostic() Diagnostic
+}
+
+// FromError collects the diagnostics carried by err. Joined errors and
+// errors that unwrap to several errors are expanded in order. Errors that do
+// not implement Diagnoser are skipped.
+func FromError(err error) []Diagnostic {
+	if err == nil {
+		return nil
+	}
+	if d, ok := err.(Diagnoser); ok {
+		return []Diagnostic{d.Diagnostic()}
+	}
+	if multi, ok := err.(interface{ Unwrap() []error }); ok {
+		var result []Diagnostic
+		for _, e := range multi.Unwrap() {
+			result = append(result, FromError(e)...)
+		}
+		return result
+	}
+	if inner := errors.Unwrap(err); inner != nil {
+		return FromError(inner)
+	}
+	return nil
+}
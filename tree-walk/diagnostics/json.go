@@ -0,0 +1,51 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonDiagnostic is the wire format written by WriteJSON. Field names are
+// part of the CLI's public interface and must stay stable.
+type jsonDiagnostic struct {
+	File     string    `json:"file"`
+	Line     int       `json:"line"`
+	Column   *int      `json:"column"` // null for a span that only knows its line
+	Span     *jsonSpan `json:"span"`
+	Severity string    `json:"severity"`
+	Code     Code      `json:"code"`
+	Message  string    `json:"message"`
+	Notes    []string  `json:"notes,omitempty"`
+}
+
+type jsonSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// WriteJSON writes each diagnostic as a single-line JSON object, one per
+// line, so consumers can stream them. Column and span are null when the
+// diagnostic only knows its line, as for errors from the bytecode VM.
+func WriteJSON(w io.Writer, file string, ds []Diagnostic) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, d := range ds {
+		out := jsonDiagnostic{
+			File:     file,
+			Line:     d.Span.Line,
+			Severity: d.Severity.String(),
+			Code:     d.Code,
+			Message:  d.Message,
+			Notes:    d.Notes,
+		}
+		if d.Span.Column > 0 {
+			column := d.Span.Column
+			out.Column = &column
+			out.Span = &jsonSpan{Start: d.Span.Start, End: d.Span.End}
+		}
+		if err := encoder.Encode(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
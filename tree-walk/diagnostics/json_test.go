@@ -0,0 +1,43 @@
+package diagnostics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	ds := []Diagnostic{
+		{
+			Severity: Error,
+			Code:     ExpectedExpression,
+			Span:     Span{Start: 22, End: 23, Line: 2, Column: 12},
+			Message:  "Expect expression.",
+		},
+		{
+			Severity: Warning,
+			Code:     UndefinedVariable,
+			Span:     Span{Start: 0, End: 3, Line: 1, Column: 1},
+			Message:  "Undefined variable 'abc'.",
+			Notes:    []string{"Declare it with 'var'."},
+		},
+		{
+			Severity: Error,
+			Code:     DivisionByZero,
+			Span:     Span{Line: 3},
+			Message:  "Division by zero.",
+		},
+	}
+
+	var out strings.Builder
+	if err := WriteJSON(&out, "main.lox", ds); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `{"file":"main.lox","line":2,"column":12,"span":{"start":22,"end":23},"severity":"error","code":"E0101","message":"Expect expression."}
+{"file":"main.lox","line":1,"column":1,"span":{"start":0,"end":3},"severity":"warning","code":"E0301","message":"Undefined variable 'abc'.","notes":["Declare it with 'var'."]}
+{"file":"main.lox","line":3,"column":null,"span":null,"severity":"error","code":"E0305","message":"Division by zero."}
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,134 @@
+package diagnostics
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ANSI escape sequences used when color output is enabled.
+const (
+	ansiReset = "\033[0m"
+	ansiBold  = "\033[1m"
+	ansiRed   = "\033[31m"
+	ansiYel   = "\033[33m"
+	ansiCyan  = "\033[36m"
+	ansiBlue  = "\033[34m"
+)
+
+// Renderer prints diagnostics for a single source file, showing the line the
+// diagnostic points at with its span underlined.
+type Renderer struct {
+	out    io.Writer
+	source string
+	color  bool
+}
+
+// NewRenderer creates a renderer writing to out. When color is true the
+// output contains ANSI color codes.
+func NewRenderer(out io.Writer, source string, color bool) *Renderer {
+	return &Renderer{out: out, source: source, color: color}
+}
+
+// Render prints a single diagnostic, for example:
+//
+//	error[E0101]: Expect expression.
+//	 --> line 2, column 12
+//	  |
+//	2 | print (1 + ;
+//	  |            ^
+func (r *Renderer) Render(d Diagnostic) {
+	header := d.Severity.String()
+	if d.Code != "" {
+		header += "[" + string(d.Code) + "]"
+	}
+	fmt.Fprintf(r.out, "%s: %s\n",
+		r.paint(severityColor(d.Severity), header),
+		r.paint(ansiBold, d.Message))
+
+	if d.Span.Line > 0 && d.Span.Column == 0 {
+		// The span only knows its line: show the line without an underline,
+		// or just its number when the source is not available.
+		gutter := strings.Repeat(" ", len(strconv.Itoa(d.Span.Line)))
+		fmt.Fprintf(r.out, "%s%s line %d\n", gutter, r.paint(ansiBlue, "-->"), d.Span.Line)
+		if text := r.lineNumberText(d.Span.Line); text != "" {
+			fmt.Fprintf(r.out, "%s %s\n", gutter, r.paint(ansiBlue, "|"))
+			fmt.Fprintf(r.out, "%s %s %s\n", r.paint(ansiBlue, strconv.Itoa(d.Span.Line)), r.paint(ansiBlue, "|"), text)
+		}
+	} else if d.Span.Line > 0 {
+		gutter := strings.Repeat(" ", len(strconv.Itoa(d.Span.Line)))
+		fmt.Fprintf(r.out, "%s%s line %d, column %d\n", gutter, r.paint(ansiBlue, "-->"), d.Span.Line, d.Span.Column)
+
+		text := r.lineText(d.Span.Start)
+		width := underlineWidth(d.Span, text)
+		fmt.Fprintf(r.out, "%s %s\n", gutter, r.paint(ansiBlue, "|"))
+		fmt.Fprintf(r.out, "%s %s %s\n", r.paint(ansiBlue, strconv.Itoa(d.Span.Line)), r.paint(ansiBlue, "|"), text)
+		fmt.Fprintf(r.out, "%s %s %s%s\n", gutter, r.paint(ansiBlue, "|"),
+			strings.Repeat(" ", d.Span.Column-1),
+			r.paint(severityColor(d.Severity), strings.Repeat("^", width)))
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(r.out, " %s %s: %s\n", r.paint(ansiBlue, "="), r.paint(ansiCyan, "note"), note)
+	}
+}
+
+// RenderAll prints each diagnostic in turn.
+func (r *Renderer) RenderAll(ds []Diagnostic) {
+	for _, d := range ds {
+		r.Render(d)
+	}
+}
+
+// lineText returns the source line containing offset, without its newline.
+func (r *Renderer) lineText(offset int) string {
+	if offset > len(r.source) {
+		offset = len(r.source)
+	}
+	start := strings.LastIndexByte(r.source[:offset], '\n') + 1
+	end := strings.IndexByte(r.source[offset:], '\n')
+	if end < 0 {
+		return r.source[start:]
+	}
+	return strings.TrimSuffix(r.source[start:offset+end], "\r")
+}
+
+// lineNumberText returns the text of the given 1-based line.
+func (r *Renderer) lineNumberText(line int) string {
+	lines := strings.Split(r.source, "\n")
+	if line > len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[line-1], "\r")
+}
+
+func (r *Renderer) paint(code string, text string) string {
+	if !r.color {
+		return text
+	}
+	return code + text + ansiReset
+}
+
+// underlineWidth is the number of carets to draw: the span's width, clipped
+// to the end of its first line, and never less than one.
+func underlineWidth(span Span, text string) int {
+	width := span.End - span.Start
+	if remaining := len(text) - (span.Column - 1); width > remaining {
+		width = remaining
+	}
+	if width < 1 {
+		width = 1
+	}
+	return width
+}
+
+func severityColor(s Severity) string {
+	switch s {
+	case Warning:
+		return ansiYel
+	case Note:
+		return ansiCyan
+	}
+	return ansiRed
+}
@@ -0,0 +1,136 @@
+package diagnostics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRenderer_Render(t *testing.T) {
+	source := "var a = 1;\nprint a + \"b\";\n"
+
+	tests := []struct {
+		diagnostic Diagnostic
+		expected   string
+	}{
+		{
+			diagnostic: Diagnostic{
+				Severity: Error,
+				Span:     Span{Start: 21, End: 24, Line: 2, Column: 11},
+				Message:  "Operands must be two numbers or two strings.",
+			},
+			expected: `error: Operands must be two numbers or two strings.
+ --> line 2, column 11
+  |
+2 | print a + "b";
+  |           ^^^
+`,
+		},
+		{
+			diagnostic: Diagnostic{
+				Severity: Warning,
+				Span:     Span{Start: 4, End: 5, Line: 1, Column: 5},
+				Message:  "Unused variable.",
+				Notes:    []string{"Remove it or prefix it with an underscore."},
+			},
+			expected: `warning: Unused variable.
+ --> line 1, column 5
+  |
+1 | var a = 1;
+  |     ^
+ = note: Remove it or prefix it with an underscore.
+`,
+		},
+		{
+			// Spans at the end of input still get a single caret.
+			diagnostic: Diagnostic{
+				Severity: Error,
+				Span:     Span{Start: 26, End: 26, Line: 3, Column: 1},
+				Message:  "Expect expression.",
+			},
+			expected: `error: Expect expression.
+ --> line 3, column 1
+  |
+3 | 
+  | ^
+`,
+		},
+		{
+			// Spans that only know their line show it without an underline.
+			diagnostic: Diagnostic{Severity: Error, Span: Span{Line: 2}, Message: "Operands must be numbers."},
+			expected: `error: Operands must be numbers.
+ --> line 2
+  |
+2 | print a + "b";
+`,
+		},
+		{
+			// Without the source text only the line number is shown.
+			diagnostic: Diagnostic{Severity: Error, Span: Span{Line: 9}, Message: "Operands must be numbers."},
+			expected:   "error: Operands must be numbers.\n --> line 9\n",
+		},
+		{
+			diagnostic: Diagnostic{Severity: Error, Code: DivisionByZero, Message: "Division by zero."},
+			expected:   "error[E0305]: Division by zero.\n",
+		},
+		{
+			diagnostic: Diagnostic{Severity: Error, Message: "No position."},
+			expected:   "error: No position.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		NewRenderer(&out, source, false).Render(tt.diagnostic)
+		if out.String() != tt.expected {
+			t.Errorf("Diagnostic: %+v\nExpected:\n%s\nGot:\n%s", tt.diagnostic, tt.expected, out.String())
+		}
+	}
+}
+
+func TestRenderer_MultiLineSpanIsClipped(t *testing.T) {
+	source := "print \"a\nb\";"
+	d := Diagnostic{Severity: Error, Span: Span{Start: 6, End: 11, Line: 1, Column: 7}, Message: "Bad string."}
+
+	var out strings.Builder
+	NewRenderer(&out, source, false).Render(d)
+	if !strings.Contains(out.String(), "1 | print \"a\n  |       ^^\n") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
+
+func TestRenderer_Color(t *testing.T) {
+	d := Diagnostic{Severity: Error, Span: Span{Start: 0, End: 1, Line: 1, Column: 1}, Message: "Oops."}
+
+	var out strings.Builder
+	NewRenderer(&out, "x", true).Render(d)
+	if !strings.Contains(out.String(), ansiRed+"error"+ansiReset) {
+		t.Errorf("Expected colored severity, got %q", out.String())
+	}
+}
+
+type testError struct {
+	message string
+}
+
+func (e *testError) Error() string { return e.message }
+
+func (e *testError) Diagnostic() Diagnostic {
+	return Diagnostic{Severity: Error, Message: e.message}
+}
+
+func TestFromError(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", errors.Join(&testError{"first"}, errors.New("plain"), &testError{"second"}))
+
+	ds := FromError(err)
+	if len(ds) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %+v", len(ds), ds)
+	}
+	if ds[0].Message != "first" || ds[1].Message != "second" {
+		t.Errorf("Unexpected diagnostics: %+v", ds)
+	}
+	if FromError(nil) != nil {
+		t.Errorf("Expected no diagnostics for a nil error")
+	}
+}
@@ -0,0 +1,385 @@
+// Package format prints Lox programs in a canonical layout: two-space
+// indentation, one statement per line, single spaces around binary operators
+// and after commas, and braces on the line that opens them. Comments and
+// single blank lines between statements are kept, and call arguments are
+// split one per line when a statement would not fit in maxWidth columns.
+package format
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+)
+
+const (
+	indentation = "  "
+	maxWidth    = 80
+)
+
+// Source formats a Lox program. It fails with the scanner and parser errors
+// if source is not a valid program.
+func Source(source string) (string, error) {
+	tokens, comments, scanErrors := scanner.ScanTokensWithComments(source)
+	statements, ranges, err := parser.ParseProgramWithRanges(tokens)
+	if len(scanErrors) > 0 || err != nil {
+		return "", errors.Join(append(scanErrors, err)...)
+	}
+
+	p := &printer{tokens: tokens, comments: comments, ranges: ranges, lineStart: true}
+	p.stmts(statements, len(source)+1)
+	return p.b.String(), nil
+}
+
+// printer writes the formatted program. Comments are not part of the AST;
+// they are emitted by position, before the first statement that starts after
+// them or at the end of the line of the statement they follow.
+type printer struct {
+	b         strings.Builder
+	indent    int
+	lineStart bool
+
+	tokens   []scanner.Token
+	comments []scanner.Comment
+	next     int // index of the first comment not yet written
+	ranges   map[parser.Stmt]parser.Range
+	lastLine int // source line of the last thing written, 0 at a block start
+
+	wrap bool // split the arguments of the next call with arguments
+}
+
+func (p *printer) write(s string) {
+	if p.lineStart {
+		p.b.WriteString(strings.Repeat(indentation, p.indent))
+		p.lineStart = false
+	}
+	p.b.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.b.WriteString("\n")
+	p.lineStart = true
+}
+
+// stmts writes a list of statements, each on its own line, followed by any
+// comments that start before end.
+func (p *printer) stmts(statements []parser.Stmt, end int) {
+	p.list(statements, end, func(stmt parser.Stmt) { stmt.Accept(p) })
+}
+
+// list writes each statement with write, surrounded by the comments and
+// blank lines around it in the source.
+func (p *printer) list(statements []parser.Stmt, end int, write func(parser.Stmt)) {
+	p.lastLine = 0
+	for _, stmt := range statements {
+		r := p.ranges[stmt]
+		p.commentsBefore(r.First.Start)
+		p.blankLineBefore(r.First.Line)
+		write(stmt)
+		p.lastLine = r.Last.Line
+		p.trailingComments(r.Last)
+		p.newline()
+	}
+	p.commentsBefore(end)
+}
+
+// commentsBefore writes the pending comments that start before offset, each
+// on its own line.
+func (p *printer) commentsBefore(offset int) {
+	for p.next < len(p.comments) && p.comments[p.next].Start < offset {
+		c := p.comments[p.next]
+		p.blankLineBefore(c.Line)
+		p.write(c.Text)
+		p.newline()
+		p.lastLine = max(p.lastLine, c.EndLine())
+		p.next++
+	}
+}
+
+// trailingComments appends the pending comments on the line of last, the
+// final token of a statement: those that follow it with no code in between,
+// and those inside the statement, which have no place of their own in the
+// formatted code.
+func (p *printer) trailingComments(last scanner.Token) {
+	for p.next < len(p.comments) {
+		c := p.comments[p.next]
+		if c.Line != last.Line || c.Start >= last.End && p.hasCodeBetween(last.End, c.Start) {
+			return
+		}
+		p.write(" " + c.Text)
+		p.lastLine = c.EndLine()
+		p.next++
+	}
+}
+
+// blankLineBefore keeps one blank line before something on line if the
+// source had at least one.
+func (p *printer) blankLineBefore(line int) {
+	if p.lastLine > 0 && line > p.lastLine+1 {
+		p.newline()
+	}
+}
+
+// hasCodeBetween reports whether a token other than the end of input starts
+// between the offsets start and end.
+func (p *printer) hasCodeBetween(start, end int) bool {
+	i := sort.Search(len(p.tokens), func(i int) bool { return p.tokens[i].Start >= start })
+	return i < len(p.tokens) && p.tokens[i].Type != scanner.EOF && p.tokens[i].Start < end
+}
+
+func (p *printer) hasCommentBefore(offset int) bool {
+	return p.next < len(p.comments) && p.comments[p.next].Start < offset
+}
+
+// body writes a braced list of statements whose closing brace is at end.
+func (p *printer) body(statements []parser.Stmt, end int) {
+	p.write("{")
+	if len(statements) == 0 && !p.hasCommentBefore(end) {
+		p.write("}")
+		return
+	}
+	p.newline()
+	p.indent++
+	p.stmts(statements, end)
+	p.indent--
+	p.write("}")
+}
+
+// branch writes the body of an if, while or for statement on the current
+// line.
+func (p *printer) branch(stmt parser.Stmt) {
+	stmt.Accept(p)
+}
+
+// line returns prefix, expr and suffix on one line, splitting the arguments
+// of the outermost call if the line would be too long.
+func (p *printer) line(prefix string, expr parser.Expr, suffix string) string {
+	s := prefix + p.expr(expr) + suffix
+	if utf8.RuneCountInString(s)+len(indentation)*p.indent <= maxWidth {
+		return s
+	}
+	p.wrap = true
+	s = prefix + p.expr(expr) + suffix
+	p.wrap = false
+	return s
+}
+
+func (p *printer) expr(expr parser.Expr) string {
+	s, _ := expr.Accept(p)
+	return s.(string)
+}
+
+func (p *printer) VisitExpressionStmt(stmt *parser.ExpressionStmt) (interface{}, error) {
+	p.write(p.line("", stmt.Expression, ";"))
+	return nil, nil
+}
+
+func (p *printer) VisitPrintStmt(stmt *parser.PrintStmt) (interface{}, error) {
+	p.write(p.line("print ", stmt.Expression, ";"))
+	return nil, nil
+}
+
+func (p *printer) VisitVarStmt(stmt *parser.VarStmt) (interface{}, error) {
+	p.write(p.varDecl(stmt))
+	return nil, nil
+}
+
+func (p *printer) varDecl(stmt *parser.VarStmt) string {
+	if stmt.Initializer == nil {
+		return "var " + stmt.Name.Lexeme + ";"
+	}
+	return p.line("var "+stmt.Name.Lexeme+" = ", stmt.Initializer, ";")
+}
+
+func (p *printer) VisitBlockStmt(stmt *parser.BlockStmt) (interface{}, error) {
+	if len(stmt.Statements) == 2 {
+		if loop, ok := stmt.Statements[1].(*parser.WhileStmt); ok && loop.For != nil && loop.For.Initializer {
+			p.forLoop(stmt.Statements[0], loop)
+			return nil, nil
+		}
+	}
+	p.body(stmt.Statements, p.ranges[stmt].Last.Start)
+	return nil, nil
+}
+
+func (p *printer) VisitIfStmt(stmt *parser.IfStmt) (interface{}, error) {
+	p.write(p.line("if (", stmt.Condition, ") "))
+	p.branch(stmt.ThenBranch)
+	if stmt.ElseBranch == nil {
+		return nil, nil
+	}
+	if _, ok := stmt.ThenBranch.(*parser.BlockStmt); ok {
+		p.write(" else ")
+	} else {
+		p.newline()
+		p.write("else ")
+	}
+	p.branch(stmt.ElseBranch)
+	return nil, nil
+}
+
+func (p *printer) VisitWhileStmt(stmt *parser.WhileStmt) (interface{}, error) {
+	if stmt.For != nil {
+		p.forLoop(nil, stmt)
+		return nil, nil
+	}
+	p.write(p.line("while (", stmt.Condition, ") "))
+	p.branch(stmt.Body)
+	return nil, nil
+}
+
+// forLoop writes a while loop desugared from a for loop in its original
+// form.
+func (p *printer) forLoop(initializer parser.Stmt, loop *parser.WhileStmt) {
+	header := "for ("
+	switch init := initializer.(type) {
+	case *parser.VarStmt:
+		header += p.varDecl(init)
+	case *parser.ExpressionStmt:
+		header += p.expr(init.Expression) + ";"
+	default:
+		header += ";"
+	}
+	if loop.For.Condition {
+		header += " " + p.expr(loop.Condition)
+	}
+	header += ";"
+
+	body := loop.Body
+	if loop.For.Increment {
+		block := body.(*parser.BlockStmt)
+		body = block.Statements[0]
+		header += " " + p.expr(block.Statements[1].(*parser.ExpressionStmt).Expression)
+	}
+
+	p.write(header + ") ")
+	p.branch(body)
+}
+
+func (p *printer) VisitFunctionStmt(stmt *parser.FunctionStmt) (interface{}, error) {
+	p.function("fun ", stmt)
+	return nil, nil
+}
+
+func (p *printer) function(keyword string, stmt *parser.FunctionStmt) {
+	params := make([]string, len(stmt.Params))
+	for i, param := range stmt.Params {
+		params[i] = param.Lexeme
+	}
+	p.write(keyword + stmt.Name.Lexeme + "(" + strings.Join(params, ", ") + ") ")
+	p.body(stmt.Body, p.ranges[stmt].Last.Start)
+}
+
+func (p *printer) VisitReturnStmt(stmt *parser.ReturnStmt) (interface{}, error) {
+	if stmt.Value == nil {
+		p.write("return;")
+		return nil, nil
+	}
+	p.write(p.line("return ", stmt.Value, ";"))
+	return nil, nil
+}
+
+func (p *printer) VisitClassStmt(stmt *parser.ClassStmt) (interface{}, error) {
+	header := "class " + stmt.Name.Lexeme
+	if stmt.Superclass != nil {
+		header += " < " + stmt.Superclass.Name.Lexeme
+	}
+	p.write(header + " {")
+
+	end := p.ranges[stmt].Last.Start
+	if len(stmt.Methods) == 0 && !p.hasCommentBefore(end) {
+		p.write("}")
+		return nil, nil
+	}
+	methods := make([]parser.Stmt, len(stmt.Methods))
+	for i, method := range stmt.Methods {
+		methods[i] = method
+	}
+	p.newline()
+	p.indent++
+	p.list(methods, end, func(method parser.Stmt) {
+		p.function("", method.(*parser.FunctionStmt))
+	})
+	p.indent--
+	p.write("}")
+	return nil, nil
+}
+
+func (p *printer) VisitBinaryExpr(expr *parser.BinaryExpr) (interface{}, error) {
+	return p.expr(expr.Left) + " " + expr.Operator.Lexeme + " " + p.expr(expr.Right), nil
+}
+
+func (p *printer) VisitGroupingExpr(expr *parser.GroupingExpr) (interface{}, error) {
+	return "(" + p.expr(expr.Expression) + ")", nil
+}
+
+func (p *printer) VisitLiteralExpr(expr *parser.LiteralExpr) (interface{}, error) {
+	switch value := expr.Value.Interface().(type) {
+	case nil:
+		return "nil", nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case string:
+		return `"` + value + `"`, nil
+	}
+	return "", errors.New("format: unknown literal type")
+}
+
+func (p *printer) VisitUnaryExpr(expr *parser.UnaryExpr) (interface{}, error) {
+	return expr.Operator.Lexeme + p.expr(expr.Right), nil
+}
+
+func (p *printer) VisitVariableExpr(expr *parser.VariableExpr) (interface{}, error) {
+	return expr.Name.Lexeme, nil
+}
+
+func (p *printer) VisitAssignExpr(expr *parser.AssignExpr) (interface{}, error) {
+	return expr.Name.Lexeme + " = " + p.expr(expr.Value), nil
+}
+
+func (p *printer) VisitLogicalExpr(expr *parser.LogicalExpr) (interface{}, error) {
+	return p.expr(expr.Left) + " " + expr.Operator.Lexeme + " " + p.expr(expr.Right), nil
+}
+
+func (p *printer) VisitCallExpr(expr *parser.CallExpr) (interface{}, error) {
+	callee := p.expr(expr.Callee)
+	wrap := p.wrap && len(expr.Arguments) > 0
+	if wrap {
+		// Only the outermost call is split; its arguments stay on one line.
+		p.wrap = false
+	}
+
+	arguments := make([]string, len(expr.Arguments))
+	for i, argument := range expr.Arguments {
+		arguments[i] = p.expr(argument)
+	}
+	if !wrap {
+		return callee + "(" + strings.Join(arguments, ", ") + ")", nil
+	}
+
+	outer := strings.Repeat(indentation, p.indent)
+	inner := outer + indentation
+	return callee + "(\n" + inner + strings.Join(arguments, ",\n"+inner) + "\n" + outer + ")", nil
+}
+
+func (p *printer) VisitGetExpr(expr *parser.GetExpr) (interface{}, error) {
+	return p.expr(expr.Object) + "." + expr.Name.Lexeme, nil
+}
+
+func (p *printer) VisitSetExpr(expr *parser.SetExpr) (interface{}, error) {
+	return p.expr(expr.Object) + "." + expr.Name.Lexeme + " = " + p.expr(expr.Value), nil
+}
+
+func (p *printer) VisitThisExpr(expr *parser.ThisExpr) (interface{}, error) {
+	return "this", nil
+}
+
+func (p *printer) VisitSuperExpr(expr *parser.SuperExpr) (interface{}, error) {
+	return "super." + expr.Method.Lexeme, nil
+}
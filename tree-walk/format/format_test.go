@@ -0,0 +1,83 @@
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"spacing", "var   a=1 ;print(a+2)*-a;", "var a = 1;\nprint (a + 2) * -a;\n"},
+		{"literals", "print nil;print true;print 1.50;print \"s\";", "print nil;\nprint true;\nprint 1.5;\nprint \"s\";\n"},
+		{"logical and calls", "f(a,b)(c).d=!x and y or z;", "f(a, b)(c).d = !x and y or z;\n"},
+		{"blocks", "{var a;{}}", "{\n  var a;\n  {}\n}\n"},
+		{"if else", "if(a)print 1;else print 2;", "if (a) print 1;\nelse print 2;\n"},
+		{"if else blocks", "if(a){print 1;}else if(b){print 2;}else{print 3;}",
+			"if (a) {\n  print 1;\n} else if (b) {\n  print 2;\n} else {\n  print 3;\n}\n"},
+		{"while", "while(a<1)a=a+1;", "while (a < 1) a = a + 1;\n"},
+		{"for", "for(var i=0;i<1;i=i+1){print i;}", "for (var i = 0; i < 1; i = i + 1) {\n  print i;\n}\n"},
+		{"for clauses", "for(;;)print 1;for(i=0;;)print 1;for(;i;)print 1;for(;;i=i+1)print 1;",
+			"for (;;) print 1;\nfor (i = 0;;) print 1;\nfor (; i;) print 1;\nfor (;; i = i + 1) print 1;\n"},
+		{"explicit while block", "{var i=0;while(i<1)i=i+1;}", "{\n  var i = 0;\n  while (i < 1) i = i + 1;\n}\n"},
+		{"functions", "fun f(a,b){return;}fun g(){}", "fun f(a, b) {\n  return;\n}\nfun g() {}\n"},
+		{"classes", "class A<B{m(){return this.x;}n(){}}class C{}",
+			"class A < B {\n  m() {\n    return this.x;\n  }\n  n() {}\n}\nclass C {}\n"},
+		{"super", "class A<B{m(){return super.m();}}", "class A < B {\n  m() {\n    return super.m();\n  }\n}\n"},
+		{"blank lines", "var a;\n\n\n\nvar b;\nvar c;\n", "var a;\n\nvar b;\nvar c;\n"},
+		{"no blank line at block start", "{\n\n  print 1;\n\n}\n", "{\n  print 1;\n}\n"},
+		{"comments", "// top\nvar a; // trailing\n/* block */\nprint a; /* after */ // two\n// end\n",
+			"// top\nvar a; // trailing\n/* block */\nprint a; /* after */ // two\n// end\n"},
+		{"comments in blocks", "fun f() { // opens\n  print 1;\n  // before close\n}\nclass A {\n  // only comment\n}\n",
+			"fun f() {\n  // opens\n  print 1;\n  // before close\n}\nclass A {\n  // only comment\n}\n"},
+		{"comments between methods", "class A {\n  a() {}\n\n  // b\n  b() {} // done\n}\n",
+			"class A {\n  a() {}\n\n  // b\n  b() {} // done\n}\n"},
+		{"comment inside expression", "print 1 + // one\n  2;\nprint 3;", "print 1 + 2;\n// one\nprint 3;\n"},
+		{"comment after else", "if (x) { return y; } else print \"no\"; // after else\n",
+			"if (x) {\n  return y;\n} else print \"no\"; // after else\n"},
+		{"comment in condition", "while (a < 10 /* mid */) a = a + 1;\nprint a;\n",
+			"while (a < 10) a = a + 1; /* mid */\nprint a;\n"},
+		{"only comments", "// a\n\n// b\n", "// a\n\n// b\n"},
+		{"empty", "", ""},
+		{"long call", "print someFunction(argumentNumberOne, argumentNumberTwo, argumentNumberThree, four);",
+			"print someFunction(\n  argumentNumberOne,\n  argumentNumberTwo,\n  argumentNumberThree,\n  four\n);\n"},
+		{"long nested call", "{ var result = outer(inner(argumentNumberOne, argumentNumberTwo), argumentNumberThree); }",
+			"{\n  var result = outer(\n    inner(argumentNumberOne, argumentNumberTwo),\n    argumentNumberThree\n  );\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Source(tt.source)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, got)
+			}
+
+			again, err := Source(got)
+			if err != nil {
+				t.Fatalf("Formatted output does not parse: %v", err)
+			}
+			if again != got {
+				t.Errorf("Formatting is not idempotent:\n%s\nthen:\n%s", got, again)
+			}
+		})
+	}
+}
+
+func TestSource_Errors(t *testing.T) {
+	_, err := Source("print @;\nvar = 1;")
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	expected := []string{"Unexpected character.", "Expect expression.", "Expect variable name."}
+	for _, message := range expected {
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected error to contain %q, got:\n%v", message, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package interpreter
+
+import (
+	"time"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+// LoxCallable is implemented by every value that can be called from Lox.
+type LoxCallable interface {
+	// Arity returns the number of arguments the callable expects.
+	Arity() int
+	// Call invokes the callable with already evaluated arguments.
+	Call(interpreter *Interpreter, arguments []value.Value) (value.Value, error)
+}
+
+// LoxFunction is a user-defined function together with the environment it
+// was declared in.
+type LoxFunction struct {
+	declaration   *parser.FunctionStmt
+	closure       *Environment
+	isInitializer bool
+}
+
+// NewLoxFunction creates a function that closes over closure. Initializers
+// always return the instance they were bound to.
+func NewLoxFunction(declaration *parser.FunctionStmt, closure *Environment, isInitializer bool) *LoxFunction {
+	return &LoxFunction{declaration: declaration, closure: closure, isInitializer: isInitializer}
+}
+
+// Bind returns a copy of the method with "this" bound to instance.
+func (f *LoxFunction) Bind(instance *LoxInstance) *LoxFunction {
+	environment := NewEnvironment(f.closure)
+	environment.Define("this", value.Object(instance))
+	return NewLoxFunction(f.declaration, environment, f.isInitializer)
+}
+
+func (f *LoxFunction) Arity() int {
+	return len(f.declaration.Params)
+}
+
+func (f *LoxFunction) Call(interpreter *Interpreter, arguments []value.Value) (value.Value, error) {
+	environment := NewEnvironment(f.closure)
+	for i, param := range f.declaration.Params {
+		environment.Define(param.Lexeme, arguments[i])
+	}
+
+	err := interpreter.executeBlock(f.declaration.Body, environment)
+	if ret, ok := err.(*returnValue); ok {
+		if f.isInitializer {
+			return f.closure.GetAt(0, "this"), nil
+		}
+		return ret.value, nil
+	}
+	if err != nil {
+		return value.Nil, err
+	}
+	if f.isInitializer {
+		return f.closure.GetAt(0, "this"), nil
+	}
+	return value.Nil, nil
+}
+
+func (f *LoxFunction) String() string {
+	return "<fn " + f.declaration.Name.Lexeme + ">"
+}
+
+// nativeFunction wraps a Go function so it can be called from Lox.
+type nativeFunction struct {
+	name  string
+	arity int
+	fn    func(interpreter *Interpreter, arguments []value.Value) (value.Value, error)
+}
+
+func (n *nativeFunction) Arity() int {
+	return n.arity
+}
+
+func (n *nativeFunction) Call(interpreter *Interpreter, arguments []value.Value) (value.Value, error) {
+	return n.fn(interpreter, arguments)
+}
+
+func (n *nativeFunction) String() string {
+	return "<native fn>"
+}
+
+// defineNatives installs the built-in functions into the global scope.
+func defineNatives(globals *Environment) {
+	globals.Define("clock", value.Object(&nativeFunction{
+		name:  "clock",
+		arity: 0,
+		fn: func(interpreter *Interpreter, arguments []value.Value) (value.Value, error) {
+			return value.Number(float64(time.Now().UnixNano()) / 1e9), nil
+		},
+	}))
+}
+
+// callableName is the name used for a callable in stack traces.
+func callableName(callable LoxCallable) string {
+	switch c := callable.(type) {
+	case *LoxFunction:
+		return c.declaration.Name.Lexeme
+	case *LoxClass:
+		return c.name
+	case *nativeFunction:
+		return c.name
+	}
+	return "?"
+}
+
+// returnValue unwinds the Go call stack from a return statement back to the
+// enclosing function call. It travels through the error return path.
+type returnValue struct {
+	value value.Value
+}
+
+func (r *returnValue) Error() string {
+	return "return outside of function"
+}
@@ -0,0 +1,87 @@
+package interpreter
+
+import (
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+// LoxClass is the runtime representation of a class. Calling it creates a
+// new instance.
+type LoxClass struct {
+	name       string
+	superclass *LoxClass
+	methods    map[string]*LoxFunction
+}
+
+// NewLoxClass creates a class with the given methods. superclass may be nil.
+func NewLoxClass(name string, superclass *LoxClass, methods map[string]*LoxFunction) *LoxClass {
+	return &LoxClass{name: name, superclass: superclass, methods: methods}
+}
+
+// FindMethod returns the method called name, searching up the superclass
+// chain, or nil if there is none.
+func (c *LoxClass) FindMethod(name string) *LoxFunction {
+	if method, ok := c.methods[name]; ok {
+		return method
+	}
+	if c.superclass != nil {
+		return c.superclass.FindMethod(name)
+	}
+	return nil
+}
+
+// Arity is the arity of the initializer, or zero when there is none.
+func (c *LoxClass) Arity() int {
+	if initializer := c.FindMethod("init"); initializer != nil {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+// Call creates a new instance and runs its initializer, if any.
+func (c *LoxClass) Call(interpreter *Interpreter, arguments []value.Value) (value.Value, error) {
+	instance := NewLoxInstance(c)
+	if initializer := c.FindMethod("init"); initializer != nil {
+		if _, err := initializer.Bind(instance).Call(interpreter, arguments); err != nil {
+			return value.Nil, err
+		}
+	}
+	return value.Object(instance), nil
+}
+
+func (c *LoxClass) String() string {
+	return c.name
+}
+
+// LoxInstance is an object created by calling a class.
+type LoxInstance struct {
+	class  *LoxClass
+	fields map[string]value.Value
+}
+
+// NewLoxInstance creates an instance of class with no fields set.
+func NewLoxInstance(class *LoxClass) *LoxInstance {
+	return &LoxInstance{class: class, fields: make(map[string]value.Value)}
+}
+
+// Get returns a field, or a method bound to this instance. Fields shadow
+// methods.
+func (o *LoxInstance) Get(name scanner.Token) (value.Value, error) {
+	if field, ok := o.fields[name.Lexeme]; ok {
+		return field, nil
+	}
+	if method := o.class.FindMethod(name.Lexeme); method != nil {
+		return value.Object(method.Bind(o)), nil
+	}
+	return value.Nil, runtimeError(name, diagnostics.UndefinedProperty, "Undefined property '"+name.Lexeme+"'.")
+}
+
+// Set creates or updates a field.
+func (o *LoxInstance) Set(name scanner.Token, field value.Value) {
+	o.fields[name.Lexeme] = field
+}
+
+func (o *LoxInstance) String() string {
+	return o.class.name + " instance"
+}
@@ -0,0 +1,114 @@
+package interpreter
+
+import (
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+// Environment stores variable bindings for a single scope and links to the
+// scope that encloses it. The global scope keeps a map, since it can grow
+// large in the REPL; other scopes hold few variables and keep a slice, which
+// is much cheaper to create on every call and block.
+type Environment struct {
+	enclosing *Environment
+	values    map[string]value.Value // the global scope, nil until the first Define
+	locals    []binding              // any other scope
+}
+
+type binding struct {
+	name  string
+	value value.Value
+}
+
+// NewEnvironment creates a scope nested inside enclosing. A nil enclosing
+// environment creates the global scope.
+func NewEnvironment(enclosing *Environment) *Environment {
+	return &Environment{enclosing: enclosing}
+}
+
+// Define binds name to value in this scope, replacing any previous binding.
+func (e *Environment) Define(name string, v value.Value) {
+	if e.enclosing == nil {
+		if e.values == nil {
+			e.values = make(map[string]value.Value)
+		}
+		e.values[name] = v
+		return
+	}
+	if !e.set(name, v) {
+		e.locals = append(e.locals, binding{name, v})
+	}
+}
+
+// Get looks up a variable in this scope and then in each enclosing scope.
+func (e *Environment) Get(name scanner.Token) (value.Value, error) {
+	for environment := e; environment != nil; environment = environment.enclosing {
+		if v, ok := environment.get(name.Lexeme); ok {
+			return v, nil
+		}
+	}
+	return value.Nil, runtimeError(name, diagnostics.UndefinedVariable, "Undefined variable '"+name.Lexeme+"'.")
+}
+
+// Assign updates an existing variable in the nearest scope that defines it.
+func (e *Environment) Assign(name scanner.Token, v value.Value) error {
+	for environment := e; environment != nil; environment = environment.enclosing {
+		if environment.set(name.Lexeme, v) {
+			return nil
+		}
+	}
+	return runtimeError(name, diagnostics.UndefinedVariable, "Undefined variable '"+name.Lexeme+"'.")
+}
+
+// GetAt reads a variable from the scope distance levels up the chain.
+func (e *Environment) GetAt(distance int, name string) value.Value {
+	v, _ := e.ancestor(distance).get(name)
+	return v
+}
+
+// AssignAt stores a variable in the scope distance levels up the chain.
+func (e *Environment) AssignAt(distance int, name scanner.Token, v value.Value) {
+	e.ancestor(distance).set(name.Lexeme, v)
+}
+
+func (e *Environment) ancestor(distance int) *Environment {
+	environment := e
+	for i := 0; i < distance; i++ {
+		environment = environment.enclosing
+	}
+	return environment
+}
+
+// get reads a variable defined in this scope only.
+func (e *Environment) get(name string) (value.Value, bool) {
+	if e.enclosing == nil {
+		v, ok := e.values[name]
+		return v, ok
+	}
+	for _, b := range e.locals {
+		if b.name == name {
+			return b.value, true
+		}
+	}
+	return value.Nil, false
+}
+
+// set updates a variable defined in this scope only, reporting whether it
+// was found.
+func (e *Environment) set(name string, v value.Value) bool {
+	if e.enclosing == nil {
+		if _, ok := e.values[name]; !ok {
+			return false
+		}
+		e.values[name] = v
+		return true
+	}
+	for i := range e.locals {
+		if e.locals[i].name == name {
+			e.locals[i].value = v
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+)
+
+// RuntimeError is an error raised while executing a program. Token is the
+// token of the operation that failed. Stack is the Lox call stack at the
+// point of failure, innermost frame first, ending with the top-level script.
+type RuntimeError struct {
+	Code    diagnostics.Code
+	Token   scanner.Token
+	Message string
+	Stack   []Frame
+}
+
+// Frame is one entry of a Lox stack trace: the function that was executing
+// and the line it was executing. The outermost frame is the top-level code
+// of the script, which has no function name.
+type Frame struct {
+	Function string
+	Line     int
+	TopLevel bool
+}
+
+func (f Frame) String() string {
+	if f.TopLevel {
+		return fmt.Sprintf("[line %d] in script", f.Line)
+	}
+	return fmt.Sprintf("[line %d] in %s()", f.Line, f.Function)
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("[line %d, column %d] Runtime error at '%s': %s", e.Token.Line, e.Token.Column, e.Token.Lexeme, e.Message)
+}
+
+// Traceback formats a stack trace from either engine as it is reported: a
+// header followed by one indented frame per line, innermost first.
+func Traceback(stack []Frame) string {
+	var sb strings.Builder
+	sb.WriteString("Traceback (most recent call first):")
+	for _, frame := range stack {
+		sb.WriteString("\n  ")
+		sb.WriteString(frame.String())
+	}
+	return sb.String()
+}
+
+// Diagnostic describes the error as pointing at the failing operation.
+func (e *RuntimeError) Diagnostic() diagnostics.Diagnostic {
+	return diagnostics.Diagnostic{Severity: diagnostics.Error, Code: e.Code, Span: e.Token.Span(), Message: e.Message}
+}
@@ -2,161 +2,511 @@ package interpreter
 
 import (
 	"fmt"
+	"io"
+	"os"
 
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
 	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
 	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
 )
 
-type Interpreter struct{}
+// maxCallDepth bounds the depth of Lox calls, so runaway recursion is
+// reported as a runtime error instead of overflowing the Go stack. It matches
+// the frame limit of the VM.
+const maxCallDepth = 4096
+
+type Interpreter struct {
+	out         io.Writer
+	globals     *Environment
+	environment *Environment
+	locals      map[parser.Expr]int
+	calls       []call
+}
+
+// call is an active Lox function call, recorded so runtime errors can report
+// a stack trace.
+type call struct {
+	function string
+	line     int // line of the call site in the caller
+}
 
 func NewInterpreter() *Interpreter {
-	return &Interpreter{}
+	globals := NewEnvironment(nil)
+	defineNatives(globals)
+	return &Interpreter{
+		out:         os.Stdout,
+		globals:     globals,
+		environment: globals,
+		locals:      make(map[parser.Expr]int),
+	}
 }
 
-func (i *Interpreter) Interpret(expr parser.Expr) (interface{}, error) {
-	return expr.Accept(i)
+// SetOutput changes the writer used by print statements.
+func (i *Interpreter) SetOutput(out io.Writer) {
+	i.out = out
+}
+
+// Resolve records that expr refers to a variable declared depth scopes out
+// from where it is used. It is called by the resolver before execution.
+func (i *Interpreter) Resolve(expr parser.Expr, depth int) {
+	i.locals[expr] = depth
+}
+
+// Globals returns a snapshot of the variables defined in the global scope,
+// including native functions.
+func (i *Interpreter) Globals() map[string]value.Value {
+	globals := make(map[string]value.Value, len(i.globals.values))
+	for name, value := range i.globals.values {
+		globals[name] = value
+	}
+	return globals
+}
+
+// Interpret evaluates a single expression.
+func (i *Interpreter) Interpret(expr parser.Expr) (value.Value, error) {
+	result, err := i.evaluate(expr)
+	if err != nil {
+		return value.Nil, i.captureStack(err)
+	}
+	return result, nil
+}
+
+// Execute runs every statement of a program in order, stopping at the first
+// runtime error.
+func (i *Interpreter) Execute(statements []parser.Stmt) error {
+	for _, stmt := range statements {
+		if _, err := stmt.Accept(i); err != nil {
+			return i.captureStack(err)
+		}
+	}
+	return nil
+}
+
+// captureStack attaches the current Lox call stack to err if it is a runtime
+// error that does not have one yet. It must run before the failing calls are
+// popped so the innermost frames are still present.
+func (i *Interpreter) captureStack(err error) error {
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok || runtimeErr.Stack != nil {
+		return err
+	}
+
+	line := runtimeErr.Token.Line
+	stack := make([]Frame, 0, len(i.calls)+1)
+	for n := len(i.calls) - 1; n >= 0; n-- {
+		stack = append(stack, Frame{Function: i.calls[n].function, Line: line})
+		line = i.calls[n].line
+	}
+	runtimeErr.Stack = append(stack, Frame{Line: line, TopLevel: true})
+	return runtimeErr
+}
+
+// evaluate computes the value of an expression. Expressions are dispatched
+// with a type switch rather than through Accept, whose interface{} result
+// would box every intermediate value.Value and allocate on each step (see
+// BenchmarkEvaluate).
+func (i *Interpreter) evaluate(expr parser.Expr) (value.Value, error) {
+	switch expr := expr.(type) {
+	case *parser.BinaryExpr:
+		return i.evaluateBinary(expr)
+	case *parser.UnaryExpr:
+		return i.evaluateUnary(expr)
+	case *parser.LiteralExpr:
+		return expr.Value, nil
+	case *parser.GroupingExpr:
+		return i.evaluate(expr.Expression)
+	case *parser.VariableExpr:
+		return i.lookUpVariable(expr.Name, expr)
+	case *parser.AssignExpr:
+		return i.evaluateAssign(expr)
+	case *parser.LogicalExpr:
+		return i.evaluateLogical(expr)
+	case *parser.CallExpr:
+		return i.evaluateCall(expr)
+	case *parser.GetExpr:
+		return i.evaluateGet(expr)
+	case *parser.SetExpr:
+		return i.evaluateSet(expr)
+	case *parser.ThisExpr:
+		return i.lookUpVariable(expr.Keyword, expr)
+	case *parser.SuperExpr:
+		return i.evaluateSuper(expr)
+	}
+	panic(fmt.Sprintf("interpreter: unexpected expression %T", expr))
+}
+
+// VisitExpressionStmt evaluates an expression and discards its value.
+func (i *Interpreter) VisitExpressionStmt(stmt *parser.ExpressionStmt) (interface{}, error) {
+	_, err := i.evaluate(stmt.Expression)
+	return nil, err
+}
+
+// VisitPrintStmt evaluates an expression and writes its value to the output.
+func (i *Interpreter) VisitPrintStmt(stmt *parser.PrintStmt) (interface{}, error) {
+	result, err := i.evaluate(stmt.Expression)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(i.out, Stringify(result))
+	return nil, nil
+}
+
+// VisitVarStmt defines a new variable in the current scope.
+func (i *Interpreter) VisitVarStmt(stmt *parser.VarStmt) (interface{}, error) {
+	initial := value.Nil
+	if stmt.Initializer != nil {
+		var err error
+		initial, err = i.evaluate(stmt.Initializer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	i.environment.Define(stmt.Name.Lexeme, initial)
+	return nil, nil
 }
 
-// VisitLiteralExpr evaluates a literal expression.
-func (i *Interpreter) VisitLiteralExpr(expr *parser.LiteralExpr) (interface{}, error) {
-	return expr.Value, nil
+// VisitBlockStmt executes a block in a new nested scope.
+func (i *Interpreter) VisitBlockStmt(stmt *parser.BlockStmt) (interface{}, error) {
+	return nil, i.executeBlock(stmt.Statements, NewEnvironment(i.environment))
 }
 
-// VisitGroupingExpr evaluates a grouping expression.
-func (i *Interpreter) VisitGroupingExpr(expr *parser.GroupingExpr) (interface{}, error) {
-	return expr.Expression.Accept(i)
+// executeBlock runs statements in the given environment and restores the
+// previous one afterwards, even when a statement fails.
+func (i *Interpreter) executeBlock(statements []parser.Stmt, environment *Environment) error {
+	previous := i.environment
+	i.environment = environment
+	defer func() { i.environment = previous }()
+
+	for _, stmt := range statements {
+		if _, err := stmt.Accept(i); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// VisitUnaryExpr evaluates a unary expression.
-func (i *Interpreter) VisitUnaryExpr(expr *parser.UnaryExpr) (interface{}, error) {
-	right, err := expr.Right.Accept(i)
+// VisitIfStmt executes the branch selected by the condition's truthiness.
+func (i *Interpreter) VisitIfStmt(stmt *parser.IfStmt) (interface{}, error) {
+	condition, err := i.evaluate(stmt.Condition)
 	if err != nil {
 		return nil, err
 	}
+	if condition.Truthy() {
+		return stmt.ThenBranch.Accept(i)
+	} else if stmt.ElseBranch != nil {
+		return stmt.ElseBranch.Accept(i)
+	}
+	return nil, nil
+}
+
+// VisitWhileStmt executes the body for as long as the condition is truthy.
+func (i *Interpreter) VisitWhileStmt(stmt *parser.WhileStmt) (interface{}, error) {
+	for {
+		condition, err := i.evaluate(stmt.Condition)
+		if err != nil {
+			return nil, err
+		}
+		if !condition.Truthy() {
+			return nil, nil
+		}
+		if _, err := stmt.Body.Accept(i); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// evaluateLogical evaluates "and" and "or" with short-circuiting. The result
+// is the value of the operand that decided the outcome, not a boolean.
+func (i *Interpreter) evaluateLogical(expr *parser.LogicalExpr) (value.Value, error) {
+	left, err := i.evaluate(expr.Left)
+	if err != nil {
+		return value.Nil, err
+	}
+
+	if expr.Operator.Type == scanner.OR {
+		if left.Truthy() {
+			return left, nil
+		}
+	} else if !left.Truthy() {
+		return left, nil
+	}
+
+	return i.evaluate(expr.Right)
+}
+
+// VisitFunctionStmt binds a new function, closing over the current scope.
+func (i *Interpreter) VisitFunctionStmt(stmt *parser.FunctionStmt) (interface{}, error) {
+	i.environment.Define(stmt.Name.Lexeme, value.Object(NewLoxFunction(stmt, i.environment, false)))
+	return nil, nil
+}
+
+// VisitClassStmt binds a new class with its methods.
+func (i *Interpreter) VisitClassStmt(stmt *parser.ClassStmt) (interface{}, error) {
+	var superclass *LoxClass
+	if stmt.Superclass != nil {
+		super, err := i.evaluate(stmt.Superclass)
+		if err != nil {
+			return nil, err
+		}
+		class, ok := super.AsObject().(*LoxClass)
+		if !ok {
+			return nil, runtimeError(stmt.Superclass.Name, diagnostics.SuperclassNotClass, "Superclass must be a class.")
+		}
+		superclass = class
+	}
+
+	i.environment.Define(stmt.Name.Lexeme, value.Nil)
+
+	if superclass != nil {
+		i.environment = NewEnvironment(i.environment)
+		i.environment.Define("super", value.Object(superclass))
+	}
+
+	methods := make(map[string]*LoxFunction, len(stmt.Methods))
+	for _, method := range stmt.Methods {
+		methods[method.Name.Lexeme] = NewLoxFunction(method, i.environment, method.Name.Lexeme == "init")
+	}
+
+	class := NewLoxClass(stmt.Name.Lexeme, superclass, methods)
+
+	if superclass != nil {
+		i.environment = i.environment.enclosing
+	}
+
+	if err := i.environment.Assign(stmt.Name, value.Object(class)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// VisitReturnStmt evaluates the return value and unwinds to the caller.
+func (i *Interpreter) VisitReturnStmt(stmt *parser.ReturnStmt) (interface{}, error) {
+	result := value.Nil
+	if stmt.Value != nil {
+		var err error
+		result, err = i.evaluate(stmt.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, &returnValue{value: result}
+}
+
+// evaluateCall evaluates the callee and arguments and invokes the callee.
+func (i *Interpreter) evaluateCall(expr *parser.CallExpr) (value.Value, error) {
+	callee, err := i.evaluate(expr.Callee)
+	if err != nil {
+		return value.Nil, err
+	}
+
+	arguments := make([]value.Value, 0, len(expr.Arguments))
+	for _, argument := range expr.Arguments {
+		result, err := i.evaluate(argument)
+		if err != nil {
+			return value.Nil, err
+		}
+		arguments = append(arguments, result)
+	}
+
+	function, ok := callee.AsObject().(LoxCallable)
+	if !ok {
+		return value.Nil, runtimeError(expr.Paren, diagnostics.NotCallable, "Can only call functions and classes.")
+	}
+	if len(arguments) != function.Arity() {
+		return value.Nil, runtimeError(expr.Paren, diagnostics.ArityMismatch, fmt.Sprintf("Expected %d arguments but got %d.", function.Arity(), len(arguments)))
+	}
+
+	if len(i.calls) == maxCallDepth {
+		return value.Nil, runtimeError(expr.Paren, diagnostics.StackOverflow, "Stack overflow.")
+	}
+	i.calls = append(i.calls, call{function: callableName(function), line: expr.Paren.Line})
+	defer func() { i.calls = i.calls[:len(i.calls)-1] }()
+
+	result, err := function.Call(i, arguments)
+	if err != nil {
+		return value.Nil, i.captureStack(err)
+	}
+	return result, nil
+}
+
+// evaluateGet reads a property from an instance.
+func (i *Interpreter) evaluateGet(expr *parser.GetExpr) (value.Value, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return value.Nil, err
+	}
+	if instance, ok := object.AsObject().(*LoxInstance); ok {
+		return instance.Get(expr.Name)
+	}
+	return value.Nil, runtimeError(expr.Name, diagnostics.NotAnInstance, "Only instances have properties.")
+}
+
+// evaluateSet assigns a field on an instance.
+func (i *Interpreter) evaluateSet(expr *parser.SetExpr) (value.Value, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return value.Nil, err
+	}
+	instance, ok := object.AsObject().(*LoxInstance)
+	if !ok {
+		return value.Nil, runtimeError(expr.Name, diagnostics.NotAnInstance, "Only instances have fields.")
+	}
+
+	result, err := i.evaluate(expr.Value)
+	if err != nil {
+		return value.Nil, err
+	}
+	instance.Set(expr.Name, result)
+	return result, nil
+}
+
+// evaluateSuper looks up a method on the superclass and binds it to the
+// current instance.
+func (i *Interpreter) evaluateSuper(expr *parser.SuperExpr) (value.Value, error) {
+	distance := i.locals[expr]
+	superclass := i.environment.GetAt(distance, "super").AsObject().(*LoxClass)
+
+	// "this" is always bound one scope inside the scope holding "super".
+	object := i.environment.GetAt(distance-1, "this").AsObject().(*LoxInstance)
+
+	method := superclass.FindMethod(expr.Method.Lexeme)
+	if method == nil {
+		return value.Nil, runtimeError(expr.Method, diagnostics.UndefinedProperty, "Undefined property '"+expr.Method.Lexeme+"'.")
+	}
+	return value.Object(method.Bind(object)), nil
+}
+
+// lookUpVariable reads a resolved local from its exact scope, or falls back to
+// the globals for names the resolver left unbound.
+func (i *Interpreter) lookUpVariable(name scanner.Token, expr parser.Expr) (value.Value, error) {
+	if distance, ok := i.locals[expr]; ok {
+		return i.environment.GetAt(distance, name.Lexeme), nil
+	}
+	return i.globals.Get(name)
+}
+
+// evaluateAssign evaluates the new value and stores it in an existing
+// variable.
+func (i *Interpreter) evaluateAssign(expr *parser.AssignExpr) (value.Value, error) {
+	result, err := i.evaluate(expr.Value)
+	if err != nil {
+		return value.Nil, err
+	}
+	if distance, ok := i.locals[expr]; ok {
+		i.environment.AssignAt(distance, expr.Name, result)
+	} else if err := i.globals.Assign(expr.Name, result); err != nil {
+		return value.Nil, err
+	}
+	return result, nil
+}
+
+// evaluateUnary evaluates a unary expression.
+func (i *Interpreter) evaluateUnary(expr *parser.UnaryExpr) (value.Value, error) {
+	right, err := i.evaluate(expr.Right)
+	if err != nil {
+		return value.Nil, err
+	}
 
 	switch expr.Operator.Type {
 	case scanner.BANG:
-		return !isTruthy(right), nil
+		return value.Bool(!right.Truthy()), nil
 	case scanner.MINUS:
-		num, ok := right.(float64)
-		if !ok {
-			return nil, runtimeError(expr.Operator, "Operand must be a number.")
+		if !right.IsNumber() {
+			return value.Nil, runtimeError(expr.Operator, diagnostics.OperandType, "Operand must be a number.")
 		}
-		return -num, nil
+		return value.Number(-right.AsNumber()), nil
 	}
 
 	// Unreachable
-	return nil, nil
+	return value.Nil, nil
 }
 
-// VisitBinaryExpr evaluates a binary expression.
-func (i *Interpreter) VisitBinaryExpr(expr *parser.BinaryExpr) (interface{}, error) {
-	left, err := expr.Left.Accept(i)
+// evaluateBinary evaluates a binary expression.
+func (i *Interpreter) evaluateBinary(expr *parser.BinaryExpr) (value.Value, error) {
+	left, err := i.evaluate(expr.Left)
 	if err != nil {
-		return nil, err
+		return value.Nil, err
 	}
-	right, err := expr.Right.Accept(i)
+	right, err := i.evaluate(expr.Right)
 	if err != nil {
-		return nil, err
+		return value.Nil, err
 	}
 
 	switch expr.Operator.Type {
 	case scanner.PLUS:
 		// Handle number addition and string concatenation
-		switch leftVal := left.(type) {
-		case float64:
-			rightVal, ok := right.(float64)
-			if ok {
-				return leftVal + rightVal, nil
-			}
-		case string:
-			rightVal, ok := right.(string)
-			if ok {
-				return leftVal + rightVal, nil
+		if left.IsNumber() && right.IsNumber() {
+			return value.Number(left.AsNumber() + right.AsNumber()), nil
+		}
+		if leftStr, ok := left.AsString(); ok {
+			if rightStr, ok := right.AsString(); ok {
+				return value.String(leftStr + rightStr), nil
 			}
 		}
-		return nil, runtimeError(expr.Operator, "Operands must be two numbers or two strings.")
+		return value.Nil, runtimeError(expr.Operator, diagnostics.OperandType, "Operands must be two numbers or two strings.")
 
 	case scanner.MINUS:
-		leftNum, ok := left.(float64)
-		if !ok {
-			return nil, runtimeError(expr.Operator, "Left operand must be a number.")
-		}
-		rightNum, ok := right.(float64)
-		if !ok {
-			return nil, runtimeError(expr.Operator, "Right operand must be a number.")
+		leftNum, rightNum, err := numberOperands(expr.Operator, left, right)
+		if err != nil {
+			return value.Nil, err
 		}
-		return leftNum - rightNum, nil
+		return value.Number(leftNum - rightNum), nil
 
 	case scanner.STAR:
-		leftNum, ok := left.(float64)
-		if !ok {
-			return nil, runtimeError(expr.Operator, "Left operand must be a number.")
+		leftNum, rightNum, err := numberOperands(expr.Operator, left, right)
+		if err != nil {
+			return value.Nil, err
 		}
-		rightNum, ok := right.(float64)
-		if !ok {
-			return nil, runtimeError(expr.Operator, "Right operand must be a number.")
-		}
-		return leftNum * rightNum, nil
+		return value.Number(leftNum * rightNum), nil
 
 	case scanner.SLASH:
-		leftNum, ok := left.(float64)
-		if !ok {
-			return nil, runtimeError(expr.Operator, "Left operand must be a number.")
-		}
-		rightNum, ok := right.(float64)
-		if !ok {
-			return nil, runtimeError(expr.Operator, "Right operand must be a number.")
+		leftNum, rightNum, err := numberOperands(expr.Operator, left, right)
+		if err != nil {
+			return value.Nil, err
 		}
 		if rightNum == 0 {
-			return nil, runtimeError(expr.Operator, "Division by zero.")
+			return value.Nil, runtimeError(expr.Operator, diagnostics.DivisionByZero, "Division by zero.")
 		}
-		return leftNum / rightNum, nil
+		return value.Number(leftNum / rightNum), nil
 
 	case scanner.GREATER, scanner.GREATER_EQUAL, scanner.LESS, scanner.LESS_EQUAL:
-		leftNum, ok1 := left.(float64)
-		rightNum, ok2 := right.(float64)
-		if !ok1 || !ok2 {
-			return nil, runtimeError(expr.Operator, "Operands must be numbers.")
+		leftNum, rightNum, err := numberOperands(expr.Operator, left, right)
+		if err != nil {
+			return value.Nil, err
 		}
 		switch expr.Operator.Type {
 		case scanner.GREATER:
-			return leftNum > rightNum, nil
+			return value.Bool(leftNum > rightNum), nil
 		case scanner.GREATER_EQUAL:
-			return leftNum >= rightNum, nil
+			return value.Bool(leftNum >= rightNum), nil
 		case scanner.LESS:
-			return leftNum < rightNum, nil
+			return value.Bool(leftNum < rightNum), nil
 		case scanner.LESS_EQUAL:
-			return leftNum <= rightNum, nil
+			return value.Bool(leftNum <= rightNum), nil
 		}
 
 	case scanner.EQUAL_EQUAL:
-		return isEqual(left, right), nil
+		return value.Bool(left.Equal(right)), nil
 
 	case scanner.BANG_EQUAL:
-		return !isEqual(left, right), nil
+		return value.Bool(!left.Equal(right)), nil
 	}
 
 	// Unreachable
-	return nil, nil
+	return value.Nil, nil
 }
 
 // Helper functions
 
-func isTruthy(value interface{}) bool {
-	if value == nil {
-		return false
-	}
-	if b, ok := value.(bool); ok {
-		return b
+// numberOperands checks that both operands of a binary operator are numbers.
+func numberOperands(operator scanner.Token, left, right value.Value) (float64, float64, error) {
+	if !left.IsNumber() || !right.IsNumber() {
+		return 0, 0, runtimeError(operator, diagnostics.OperandType, "Operands must be numbers.")
 	}
-	return true
-}
-
-func isEqual(a, b interface{}) bool {
-	return a == b
+	return left.AsNumber(), right.AsNumber(), nil
 }
 
-func runtimeError(operator scanner.Token, message string) error {
-	return fmt.Errorf("[line %d] Runtime error at '%s': %s", operator.Line, operator.Lexeme, message)
+func runtimeError(operator scanner.Token, code diagnostics.Code, message string) error {
+	return &RuntimeError{Code: code, Token: operator, Message: message}
 }
@@ -1,9 +1,11 @@
 package interpreter
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/resolver"
 	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
 )
 
@@ -28,7 +30,7 @@ func TestInterpreter_EvaluateExpressions(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		tokens := scanner.ScanTokens(tt.source)
+		tokens := scanTokens(t, tt.source)
 		expr, err := parser.Parse(tokens)
 		if err != nil {
 			t.Errorf("Parse error for source: %s\nError: %v", tt.source, err)
@@ -42,7 +44,7 @@ func TestInterpreter_EvaluateExpressions(t *testing.T) {
 			continue
 		}
 
-		if !valuesEqual(result, tt.expected) {
+		if !valuesEqual(result.Interface(), tt.expected) {
 			t.Errorf("Source: %s\nExpected: %v\nGot: %v", tt.source, tt.expected, result)
 		}
 	}
@@ -55,28 +57,32 @@ func TestInterpreter_RuntimeErrors(t *testing.T) {
 	}{
 		{
 			source:        "5 / 0",
-			expectedError: "[line 1] Runtime error at '/': Division by zero.",
+			expectedError: "[line 1, column 3] Runtime error at '/': Division by zero.",
 		},
 		{
 			source:        "true + false",
-			expectedError: "[line 1] Runtime error at '+': Operands must be two numbers or two strings.",
+			expectedError: "[line 1, column 6] Runtime error at '+': Operands must be two numbers or two strings.",
 		},
 		{
 			source:        "5 + \"hello\"",
-			expectedError: "[line 1] Runtime error at '+': Operands must be two numbers or two strings.",
+			expectedError: "[line 1, column 3] Runtime error at '+': Operands must be two numbers or two strings.",
 		},
 		{
 			source:        "-\"string\"",
-			expectedError: "[line 1] Runtime error at '-': Operand must be a number.",
+			expectedError: "[line 1, column 1] Runtime error at '-': Operand must be a number.",
+		},
+		{
+			source:        "\"a\" - 1",
+			expectedError: "[line 1, column 5] Runtime error at '-': Operands must be numbers.",
 		},
 		{
 			source:        "nil > 1",
-			expectedError: "[line 1] Runtime error at '>': Operands must be numbers.",
+			expectedError: "[line 1, column 5] Runtime error at '>': Operands must be numbers.",
 		},
 	}
 
 	for _, tt := range tests {
-		tokens := scanner.ScanTokens(tt.source)
+		tokens := scanTokens(t, tt.source)
 		expr, err := parser.Parse(tokens)
 		if err != nil {
 			t.Errorf("Parse error for source: %s\nError: %v", tt.source, err)
@@ -96,6 +102,270 @@ func TestInterpreter_RuntimeErrors(t *testing.T) {
 	}
 }
 
+func TestInterpreter_ExecuteProgram(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"print 1 + 2;", "3\n"},
+		{"print \"Hello\"; print nil; print true;", "Hello\nnil\ntrue\n"},
+		{"1 + 2;", ""},
+		{"var a = 1; var b; print a; print b;", "1\nnil\n"},
+		{"var a = 1; a = a + 1; print a;", "2\n"},
+		{"var a = \"global\"; { var a = \"inner\"; print a; } print a;", "inner\nglobal\n"},
+		{"var a = 1; { a = 2; } print a;", "2\n"},
+		{"var a; var b; a = b = 3; print a + b;", "6\n"},
+		{"if (true) print 1; else print 2;", "1\n"},
+		{"if (nil) print 1; else print 2;", "2\n"},
+		{"if (false) print 1;", ""},
+		{"var i = 0; while (i < 3) { print i; i = i + 1; }", "0\n1\n2\n"},
+		{"for (var i = 0; i < 3; i = i + 1) print i;", "0\n1\n2\n"},
+		{"var i = 5; for (; i > 3;) i = i - 1; print i;", "3\n"},
+		{"print \"hi\" or 2; print nil or \"yes\";", "hi\nyes\n"},
+		{"print nil and 1; print 1 and 2;", "nil\n2\n"},
+		{"var a = 0; false and (a = 1); true or (a = 2); print a;", "0\n"},
+		{"fun add(a, b) { return a + b; } print add(1, 2);", "3\n"},
+		{"fun f() { print \"in f\"; } print f();", "in f\nnil\n"},
+		{"fun f() {} print f;", "<fn f>\n"},
+		{"print clock;", "<native fn>\n"},
+		{
+			"fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); } print fib(10);",
+			"55\n",
+		},
+		{
+			"fun makeCounter() { var i = 0; fun count() { i = i + 1; return i; } return count; }" +
+				"var c = makeCounter(); c(); print c();",
+			"2\n",
+		},
+		{
+			"var a = \"global\"; { fun show() { print a; } show(); var a = \"block\"; show(); }",
+			"global\nglobal\n",
+		},
+		{"fun f(n) { while (true) { if (n > 2) return n; n = n + 1; } } print f(0);", "3\n"},
+		{"class Bagel {} print Bagel; print Bagel();", "Bagel\nBagel instance\n"},
+		{"class Box {} var b = Box(); b.value = 3; print b.value;", "3\n"},
+		{
+			"class Greeter { greet(name) { return \"Hi \" + name; } } print Greeter().greet(\"Lox\");",
+			"Hi Lox\n",
+		},
+		{
+			"class Counter { init(start) { this.n = start; } inc() { this.n = this.n + 1; return this; } }" +
+				"print Counter(1).inc().inc().n;",
+			"3\n",
+		},
+		{
+			"class P { init() { this.x = 1; return; this.x = 2; } } var p = P(); print p.x; print p.init();",
+			"1\nP instance\n",
+		},
+		{
+			"class Cake { taste() { return this.flavor; } } var c = Cake(); c.flavor = \"lemon\";" +
+				"var m = c.taste; print m();",
+			"lemon\n",
+		},
+		{
+			"class A { say() { print \"A\"; } } class B < A {} B().say();",
+			"A\n",
+		},
+		{
+			"class A { say() { return \"A\"; } } class B < A { say() { return super.say() + \"B\"; } }" +
+				"class C < B {} print C().say();",
+			"AB\n",
+		},
+		{
+			"class A { init(x) { this.x = x; } } class B < A { init() { super.init(2); } } print B().x;",
+			"2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tokens := scanTokens(t, tt.source)
+		statements, err := parser.ParseProgram(tokens)
+		if err != nil {
+			t.Errorf("Parse error for source: %s\nError: %v", tt.source, err)
+			continue
+		}
+
+		var out strings.Builder
+		interp := NewInterpreter()
+		interp.SetOutput(&out)
+		if err := resolver.NewResolver(interp).Resolve(statements); err != nil {
+			t.Errorf("Resolve error for source: %s\nError: %v", tt.source, err)
+			continue
+		}
+		if err := interp.Execute(statements); err != nil {
+			t.Errorf("Interpretation error for source: %s\nError: %v", tt.source, err)
+			continue
+		}
+
+		if out.String() != tt.expected {
+			t.Errorf("Source: %s\nExpected output: %q\nGot: %q", tt.source, tt.expected, out.String())
+		}
+	}
+}
+
+func TestInterpreter_ProgramRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		source        string
+		expectedError string
+	}{
+		{
+			source:        "print x;",
+			expectedError: "[line 1, column 7] Runtime error at 'x': Undefined variable 'x'.",
+		},
+		{
+			source:        "{ var a = 1; }\na = 2;",
+			expectedError: "[line 2, column 1] Runtime error at 'a': Undefined variable 'a'.",
+		},
+		{
+			source:        "\"not a function\"();",
+			expectedError: "[line 1, column 18] Runtime error at ')': Can only call functions and classes.",
+		},
+		{
+			source:        "fun f(a, b) {}\nf(1);",
+			expectedError: "[line 2, column 4] Runtime error at ')': Expected 2 arguments but got 1.",
+		},
+		{
+			source:        "class A {}\nA().missing;",
+			expectedError: "[line 2, column 5] Runtime error at 'missing': Undefined property 'missing'.",
+		},
+		{
+			source:        "var s = \"str\";\ns.length;",
+			expectedError: "[line 2, column 3] Runtime error at 'length': Only instances have properties.",
+		},
+		{
+			source:        "var n = 1;\nn.x = 2;",
+			expectedError: "[line 2, column 3] Runtime error at 'x': Only instances have fields.",
+		},
+		{
+			source:        "class A { init(a) {} }\nA();",
+			expectedError: "[line 2, column 3] Runtime error at ')': Expected 1 arguments but got 0.",
+		},
+		{
+			source:        "var NotAClass = 1;\nclass A < NotAClass {}",
+			expectedError: "[line 2, column 11] Runtime error at 'NotAClass': Superclass must be a class.",
+		},
+		{
+			source:        "class A {} class B < A { m() { return super.missing; } }\nB().m();",
+			expectedError: "[line 1, column 45] Runtime error at 'missing': Undefined property 'missing'.",
+		},
+		{
+			source:        "fun f() { f(); }\nf();",
+			expectedError: "[line 1, column 13] Runtime error at ')': Stack overflow.",
+		},
+	}
+
+	for _, tt := range tests {
+		tokens := scanTokens(t, tt.source)
+		statements, err := parser.ParseProgram(tokens)
+		if err != nil {
+			t.Errorf("Parse error for source: %s\nError: %v", tt.source, err)
+			continue
+		}
+
+		interp := NewInterpreter()
+		interp.SetOutput(&strings.Builder{})
+		if err := resolver.NewResolver(interp).Resolve(statements); err != nil {
+			t.Errorf("Resolve error for source: %s\nError: %v", tt.source, err)
+			continue
+		}
+		err = interp.Execute(statements)
+		if err == nil {
+			t.Errorf("Expected runtime error for source: %s\nBut got none", tt.source)
+			continue
+		}
+
+		if err.Error() != tt.expectedError {
+			t.Errorf("Source: %s\nExpected Error: %s\nGot Error: %s", tt.source, tt.expectedError, err.Error())
+		}
+	}
+}
+
+func TestInterpreter_RuntimeErrorStack(t *testing.T) {
+	source := `fun inner(x) {
+  return x + nil;
+}
+fun outer() {
+  return inner(1);
+}
+class Box {
+  init() { this.v = outer(); }
+}
+Box();`
+
+	statements, err := parser.ParseProgram(scanTokens(t, source))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	interp := NewInterpreter()
+	if err := resolver.NewResolver(interp).Resolve(statements); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+
+	err = interp.Execute(statements)
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("Expected a *RuntimeError, got %T: %v", err, err)
+	}
+	if runtimeErr.Token.Lexeme != "+" || runtimeErr.Message != "Operands must be two numbers or two strings." {
+		t.Errorf("Unexpected error: %v", runtimeErr)
+	}
+
+	expected := `Traceback (most recent call first):
+  [line 2] in inner()
+  [line 5] in outer()
+  [line 8] in Box()
+  [line 10] in script`
+	if got := Traceback(runtimeErr.Stack); got != expected {
+		t.Errorf("Expected traceback:\n%s\nGot:\n%s", expected, got)
+	}
+
+	// The call stack is unwound after the error.
+	if len(interp.calls) != 0 {
+		t.Errorf("Expected empty call stack after error, got %v", interp.calls)
+	}
+}
+
+func TestInterpreter_RuntimeErrorStackAtTopLevel(t *testing.T) {
+	source := "fun f(a) {}\n\nf();"
+
+	statements, err := parser.ParseProgram(scanTokens(t, source))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	interp := NewInterpreter()
+	if err := resolver.NewResolver(interp).Resolve(statements); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+
+	runtimeErr, ok := interp.Execute(statements).(*RuntimeError)
+	if !ok {
+		t.Fatalf("Expected a *RuntimeError")
+	}
+	if got := Traceback(runtimeErr.Stack); got != "Traceback (most recent call first):\n  [line 3] in script" {
+		t.Errorf("Unexpected traceback:\n%s", got)
+	}
+}
+
+func TestInterpreter_RuntimeErrorStackFunctionNamedScript(t *testing.T) {
+	statements, err := parser.ParseProgram(scanTokens(t, "fun script() { return nil + 1; }\nscript();"))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	interp := NewInterpreter()
+	if err := resolver.NewResolver(interp).Resolve(statements); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+
+	runtimeErr, ok := interp.Execute(statements).(*RuntimeError)
+	if !ok {
+		t.Fatalf("Expected a *RuntimeError")
+	}
+	expected := "Traceback (most recent call first):\n  [line 1] in script()\n  [line 2] in script"
+	if got := Traceback(runtimeErr.Stack); got != expected {
+		t.Errorf("Expected traceback:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
 func valuesEqual(a, b interface{}) bool {
 	switch aVal := a.(type) {
 	case float64:
@@ -113,3 +383,117 @@ func valuesEqual(a, b interface{}) bool {
 		return false
 	}
 }
+
+func scanTokens(t *testing.T, source string) []scanner.Token {
+	t.Helper()
+	tokens, errs := scanner.ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Scan errors for source: %s\nErrors: %v", source, errs)
+	}
+	return tokens
+}
+
+// TestInterpreter_EvaluateNumbersDoesNotAllocate checks that arithmetic on
+// numbers stays off the heap, which BenchmarkEvaluate shows a visitor would
+// not.
+func TestInterpreter_EvaluateNumbersDoesNotAllocate(t *testing.T) {
+	expr, err := parser.Parse(scanTokens(t, "(1 + 2) * 3 - -4 / 2 < 10"))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	interp := NewInterpreter()
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := interp.evaluate(expr); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+}
+
+// BenchmarkEvaluate compares evaluating an expression through evaluate's
+// type switch with dispatching it through a parser.ExprVisitor, whose
+// interface{} result boxes the value.
+func BenchmarkEvaluate(b *testing.B) {
+	tokens, _ := scanner.ScanTokens("(1 + 2) * 3")
+	expr, err := parser.Parse(tokens)
+	if err != nil {
+		b.Fatal(err)
+	}
+	interp := NewInterpreter()
+
+	b.Run("switch", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			if _, err := interp.evaluate(expr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("visitor", func(b *testing.B) {
+		visitor := exprVisitor{interp}
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			if _, err := expr.Accept(visitor); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// exprVisitor evaluates expressions through parser.ExprVisitor, for
+// BenchmarkEvaluate.
+type exprVisitor struct{ interp *Interpreter }
+
+func (v exprVisitor) visit(expr parser.Expr) (interface{}, error) {
+	return v.interp.evaluate(expr)
+}
+
+func (v exprVisitor) VisitBinaryExpr(expr *parser.BinaryExpr) (interface{}, error) {
+	return v.visit(expr)
+}
+
+func (v exprVisitor) VisitUnaryExpr(expr *parser.UnaryExpr) (interface{}, error) {
+	return v.visit(expr)
+}
+
+func (v exprVisitor) VisitLiteralExpr(expr *parser.LiteralExpr) (interface{}, error) {
+	return v.visit(expr)
+}
+
+func (v exprVisitor) VisitGroupingExpr(expr *parser.GroupingExpr) (interface{}, error) {
+	return v.visit(expr)
+}
+
+func (v exprVisitor) VisitVariableExpr(expr *parser.VariableExpr) (interface{}, error) {
+	return v.visit(expr)
+}
+
+func (v exprVisitor) VisitAssignExpr(expr *parser.AssignExpr) (interface{}, error) {
+	return v.visit(expr)
+}
+
+func (v exprVisitor) VisitLogicalExpr(expr *parser.LogicalExpr) (interface{}, error) {
+	return v.visit(expr)
+}
+
+func (v exprVisitor) VisitCallExpr(expr *parser.CallExpr) (interface{}, error) {
+	return v.visit(expr)
+}
+
+func (v exprVisitor) VisitGetExpr(expr *parser.GetExpr) (interface{}, error) {
+	return v.visit(expr)
+}
+
+func (v exprVisitor) VisitSetExpr(expr *parser.SetExpr) (interface{}, error) {
+	return v.visit(expr)
+}
+
+func (v exprVisitor) VisitThisExpr(expr *parser.ThisExpr) (interface{}, error) {
+	return v.visit(expr)
+}
+
+func (v exprVisitor) VisitSuperExpr(expr *parser.SuperExpr) (interface{}, error) {
+	return v.visit(expr)
+}
@@ -0,0 +1,14 @@
+package interpreter
+
+import "github.com/acautin/lox-implementation-exercise/tree-walk/value"
+
+// Stringify formats a Lox value the way print shows it. Both engines' print,
+// the REPL echo and :env all format values through it. It accepts a
+// value.Value or a plain Go value as produced by the scanner (nil, bool,
+// float64 or string); see value.Value.String for the format.
+func Stringify(v interface{}) string {
+	if v, ok := v.(value.Value); ok {
+		return v.String()
+	}
+	return value.Of(v).String()
+}
@@ -0,0 +1,43 @@
+package interpreter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+func TestStringify(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "nil"},
+		{true, "true"},
+		{false, "false"},
+		{"text", "text"},
+		{1.0, "1"},
+		{0.0, "0"},
+		{math.Copysign(0, -1), "-0"},
+		{123456789.0, "123456789"},
+		{1e20, "100000000000000000000"},
+		{1e21, "1e+21"},
+		{123.456, "123.456"},
+		{-0.001, "-0.001"},
+		{0.30000000000000004, "0.30000000000000004"},
+		{1234567.5, "1234567.5"},
+		{1e-7, "1e-07"},
+		{math.NaN(), "NaN"},
+		{math.Inf(1), "Infinity"},
+		{math.Inf(-1), "-Infinity"},
+		{value.Number(2.5), "2.5"},
+		{value.String("v"), "v"},
+		{value.Nil, "nil"},
+	}
+
+	for _, tt := range tests {
+		if got := Stringify(tt.value); got != tt.expected {
+			t.Errorf("Stringify(%v): expected %q, got %q", tt.value, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+// Package lineedit is a small line editor for interactive prompts. On a
+// terminal it supports cursor movement, history recall with the arrow keys,
+// the common Emacs-style control keys and tab completion. When input is not a
+// terminal, or on platforms other than Linux, macOS and the BSDs, it falls
+// back to reading plain lines.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var ErrInterrupted = errors.New("interrupted")
+
+// defaultMaxHistory is the number of history entries kept by New.
+const defaultMaxHistory = 1000
+
+// Control keys understood while editing.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBell      = 7
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// Editor reads lines from a terminal.
+type Editor struct {
+	in     *os.File
+	out    io.Writer
+	reader *bufio.Reader
+
+	// Complete returns the candidates for completing word, the identifier
+	// immediately before the cursor. It is called when Tab is pressed; a nil
+	// Complete disables completion.
+	Complete func(word string) []string
+
+	// MaxHistory is the number of entries kept in memory.
+	MaxHistory int
+
+	history     []string
+	historyFile string
+}
+
+// New creates an editor reading from in and echoing to out.
+func New(in *os.File, out io.Writer) *Editor {
+	return &Editor{in: in, out: out, reader: bufio.NewReader(in), MaxHistory: defaultMaxHistory}
+}
+
+// ReadLine shows prompt and returns the next line without its line ending.
+// It returns io.EOF at the end of input or when Ctrl-D is pressed on an empty
+// line, and ErrInterrupted when Ctrl-C is pressed.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.in)
+	if err != nil {
+		fmt.Fprint(e.out, prompt)
+		return e.readPlain()
+	}
+	defer restore()
+	return e.edit(prompt)
+}
+
+// readPlain reads a line without any editing support.
+func (e *Editor) readPlain() (string, error) {
+	line, err := e.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// History returns the history entries, oldest first.
+func (e *Editor) History() []string {
+	return append([]string(nil), e.history...)
+}
+
+// LoadHistory reads previous entries from path and appends every line added
+// from now on to it. A missing file is not an error.
+func (e *Editor) LoadHistory(path string) error {
+	e.historyFile = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.remember(line)
+		}
+	}
+	return nil
+}
+
+// AddHistory records line so it can be recalled with the arrow keys. Empty
+// lines and repeats of the previous entry are ignored.
+func (e *Editor) AddHistory(line string) error {
+	if !e.remember(line) || e.historyFile == "" {
+		return nil
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// remember adds line to the in-memory history, reporting whether it was
+// added.
+func (e *Editor) remember(line string) bool {
+	if strings.TrimSpace(line) == "" || strings.ContainsRune(line, '\n') {
+		return false
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return false
+	}
+	e.history = append(e.history, line)
+	if e.MaxHistory > 0 && len(e.history) > e.MaxHistory {
+		e.history = e.history[len(e.history)-e.MaxHistory:]
+	}
+	return true
+}
+
+// lineState is the line being edited.
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int // cursor position in buf
+
+	historyIndex int    // entry being shown; len(history) is the new line
+	saved        string // the new line, kept while browsing history
+}
+
+// edit reads keys until the line is submitted, redrawing it after each one.
+func (e *Editor) edit(prompt string) (string, error) {
+	s := &lineState{prompt: prompt, historyIndex: len(e.history)}
+	e.refresh(s)
+
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, keyLineFeed:
+			fmt.Fprint(e.out, "\r\n")
+			return string(s.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(s.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			s.deleteForward()
+		case keyBackspace, keyCtrlH:
+			s.deleteBackward()
+		case keyCtrlA:
+			s.pos = 0
+		case keyCtrlE:
+			s.pos = len(s.buf)
+		case keyCtrlB:
+			s.moveLeft()
+		case keyCtrlF:
+			s.moveRight()
+		case keyCtrlK:
+			s.buf = s.buf[:s.pos]
+		case keyCtrlU:
+			s.buf = append([]rune(nil), s.buf[s.pos:]...)
+			s.pos = 0
+		case keyCtrlW:
+			s.deleteWord()
+		case keyCtrlP:
+			e.historyPrev(s)
+		case keyCtrlN:
+			e.historyNext(s)
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyTab:
+			e.complete(s)
+		case keyEscape:
+			e.escape(s)
+		default:
+			if unicode.IsPrint(r) {
+				s.insert([]rune{r})
+			}
+		}
+		e.refresh(s)
+	}
+}
+
+// escape handles the ANSI escape sequences sent by arrow, Home, End and
+// Delete keys. Unknown sequences are ignored.
+func (e *Editor) escape(s *lineState) {
+	introducer, _, err := e.reader.ReadRune()
+	if err != nil || (introducer != '[' && introducer != 'O') {
+		return
+	}
+
+	var param strings.Builder
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return
+		}
+		if r >= '0' && r <= '9' || r == ';' {
+			param.WriteRune(r)
+			continue
+		}
+
+		switch {
+		case r == 'A':
+			e.historyPrev(s)
+		case r == 'B':
+			e.historyNext(s)
+		case r == 'C':
+			s.moveRight()
+		case r == 'D':
+			s.moveLeft()
+		case r == 'H':
+			s.pos = 0
+		case r == 'F':
+			s.pos = len(s.buf)
+		case r == '~':
+			switch param.String() {
+			case "1", "7":
+				s.pos = 0
+			case "4", "8":
+				s.pos = len(s.buf)
+			case "3":
+				s.deleteForward()
+			}
+		}
+		return
+	}
+}
+
+// refresh redraws the prompt and line and places the cursor.
+func (e *Editor) refresh(s *lineState) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", s.prompt, string(s.buf))
+	if back := len(s.buf) - s.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+func (e *Editor) historyPrev(s *lineState) {
+	if s.historyIndex == 0 {
+		return
+	}
+	if s.historyIndex == len(e.history) {
+		s.saved = string(s.buf)
+	}
+	s.historyIndex--
+	s.set(e.history[s.historyIndex])
+}
+
+func (e *Editor) historyNext(s *lineState) {
+	if s.historyIndex >= len(e.history) {
+		return
+	}
+	s.historyIndex++
+	if s.historyIndex == len(e.history) {
+		s.set(s.saved)
+	} else {
+		s.set(e.history[s.historyIndex])
+	}
+}
+
+// complete completes the word before the cursor. A single candidate is
+// inserted in full; several are completed to their longest common prefix,
+// and listed below the line if that adds nothing.
+func (e *Editor) complete(s *lineState) {
+	if e.Complete == nil {
+		return
+	}
+	start := s.pos
+	for start > 0 && isWordRune(s.buf[start-1]) {
+		start--
+	}
+	word := string(s.buf[start:s.pos])
+
+	var candidates []string
+	for _, c := range e.Complete(word) {
+		if strings.HasPrefix(c, word) {
+			candidates = append(candidates, c)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		fmt.Fprint(e.out, string(rune(keyBell)))
+	case 1:
+		s.insert([]rune(candidates[0][len(word):]))
+	default:
+		prefix := commonPrefix(candidates)
+		if len(prefix) > len(word) {
+			s.insert([]rune(prefix[len(word):]))
+			return
+		}
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+func (s *lineState) set(line string) {
+	s.buf = []rune(line)
+	s.pos = len(s.buf)
+}
+
+func (s *lineState) insert(runes []rune) {
+	buf := make([]rune, 0, len(s.buf)+len(runes))
+	buf = append(buf, s.buf[:s.pos]...)
+	buf = append(buf, runes...)
+	s.buf = append(buf, s.buf[s.pos:]...)
+	s.pos += len(runes)
+}
+
+func (s *lineState) moveLeft() {
+	if s.pos > 0 {
+		s.pos--
+	}
+}
+
+func (s *lineState) moveRight() {
+	if s.pos < len(s.buf) {
+		s.pos++
+	}
+}
+
+func (s *lineState) deleteBackward() {
+	if s.pos > 0 {
+		s.buf = append(s.buf[:s.pos-1], s.buf[s.pos:]...)
+		s.pos--
+	}
+}
+
+func (s *lineState) deleteForward() {
+	if s.pos < len(s.buf) {
+		s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+	}
+}
+
+// deleteWord deletes the word before the cursor and any spaces after it.
+func (s *lineState) deleteWord() {
+	start := s.pos
+	for start > 0 && s.buf[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && s.buf[start-1] != ' ' {
+		start--
+	}
+	s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+	s.pos = start
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,177 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// editInput runs the editor over keys as if they were typed on a terminal.
+func editInput(e *Editor, keys string) (string, error) {
+	e.reader = bufio.NewReader(strings.NewReader(keys))
+	e.out = io.Discard
+	return e.edit("> ")
+}
+
+func TestEditor_Editing(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{"plain", "print 1;\r", "print 1;"},
+		{"backspace", "prinx\x7ft 1;\r", "print 1;"},
+		{"left arrow insert", "prit\x1b[Dn\r", "print"},
+		{"home and end", "rint\x1b[Hp\x1b[F;\r", "print;"},
+		{"ctrl-a and ctrl-e", "b\x01a\x05c\r", "abc"},
+		{"delete key", "abc\x1b[D\x1b[D\x1b[3~\r", "ac"},
+		{"ctrl-k", "abcdef\x1b[D\x1b[D\x1b[D\x0b\r", "abc"},
+		{"ctrl-u", "abcdef\x1b[D\x1b[D\x15\r", "ef"},
+		{"ctrl-w", "var answer = 42\x17\x17\r", "var answer "},
+		{"ctrl-d deletes", "ab\x01\x04\r", "b"},
+		{"unknown escape ignored", "a\x1b[5~b\r", "ab"},
+		{"utf-8", "\"héllo\"\x1b[D\x7f\r", "\"héll\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := editInput(&Editor{}, tt.keys)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if line != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, line)
+			}
+		})
+	}
+}
+
+func TestEditor_ControlErrors(t *testing.T) {
+	if _, err := editInput(&Editor{}, "\x04"); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line: expected io.EOF, got %v", err)
+	}
+	if _, err := editInput(&Editor{}, "abc\x03"); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Ctrl-C: expected ErrInterrupted, got %v", err)
+	}
+	if _, err := editInput(&Editor{}, "abc"); err != io.EOF {
+		t.Errorf("End of input: expected io.EOF, got %v", err)
+	}
+}
+
+func TestEditor_History(t *testing.T) {
+	e := &Editor{}
+	for _, line := range []string{"first", "second", "second", "", "third"} {
+		e.AddHistory(line)
+	}
+	if got := strings.Join(e.History(), ","); got != "first,second,third" {
+		t.Fatalf("Unexpected history %q", got)
+	}
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"\x1b[A\r", "third"},
+		{"\x1b[A\x1b[A\x1b[A\x1b[A\r", "first"},
+		{"\x1b[A\x1b[A\x1b[B\r", "third"},
+		{"new\x1b[A\x1b[B\r", "new"},
+		{"\x10\x10!\r", "second!"},
+	}
+	for _, tt := range tests {
+		line, err := editInput(e, tt.keys)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if line != tt.expected {
+			t.Errorf("Keys %q: expected %q, got %q", tt.keys, tt.expected, line)
+		}
+	}
+}
+
+func TestEditor_HistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Editor{MaxHistory: 2}
+	if err := e.LoadHistory(path); err != nil {
+		t.Fatalf("LoadHistory: %v", err)
+	}
+	if err := e.AddHistory("three"); err != nil {
+		t.Fatalf("AddHistory: %v", err)
+	}
+	if got := strings.Join(e.History(), ","); got != "two,three" {
+		t.Errorf("Expected in-memory history two,three, got %q", got)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "one\ntwo\nthree\n" {
+		t.Errorf("Unexpected history file %q", data)
+	}
+
+	if err := (&Editor{}).LoadHistory(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("Missing history file: %v", err)
+	}
+}
+
+func TestEditor_Complete(t *testing.T) {
+	words := []string{"class", "clock", "print", "prime", "primes"}
+	complete := func(word string) []string { return words }
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"pr\t\r", "pri"},
+		{"cla\t\r", "class"},
+		{"print clo\t()\r", "print clock()"},
+		{"cl\t\r", "cl"},
+		{"x\t\r", "x"},
+	}
+	for _, tt := range tests {
+		line, err := editInput(&Editor{Complete: complete}, tt.keys)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if line != tt.expected {
+			t.Errorf("Keys %q: expected %q, got %q", tt.keys, tt.expected, line)
+		}
+	}
+}
+
+func TestEditor_ReadLineWithoutTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		w.WriteString("print 1;\r\nlast")
+		w.Close()
+	}()
+
+	var out strings.Builder
+	e := New(r, &out)
+	for _, expected := range []string{"print 1;", "last"} {
+		line, err := e.ReadLine("> ")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if line != expected {
+			t.Errorf("Expected %q, got %q", expected, line)
+		}
+	}
+	if _, err := e.ReadLine("> "); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+	if out.String() != "> > > " {
+		t.Errorf("Expected prompts to be echoed, got %q", out.String())
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package lineedit
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw is only implemented on Linux and the BSD family, including macOS;
+// elsewhere the editor reads plain lines.
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
@@ -1,75 +1,192 @@
 package main
 
 import (
-	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/acautin/lox-implementation-exercise/tree-walk/interpreter"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/optimizer"
 	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/resolver"
 	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/vm"
+)
+
+// Exit codes follow the BSD sysexits conventions used by the reference Lox
+// implementation and its test suite.
+const (
+	exitUsage    = 64 // EX_USAGE: bad command line
+	exitDataErr  = 65 // EX_DATAERR: scan, parse or resolve error
+	exitSoftware = 70 // EX_SOFTWARE: runtime error
+	exitIOErr    = 74 // EX_IOERR: script could not be read
+)
+
+var (
+	diagnosticsFormat = flag.String("diagnostics", "auto", diagnosticsUsage)
+	inlineSource      = flag.String("e", "", inlineUsage)
+	engine            = flag.String("engine", "tree", engineUsage)
+	traceExec         = flag.Bool("trace-exec", false, traceExecUsage)
+	noOpt             = flag.Bool("no-opt", false, noOptUsage)
+)
+
+const (
+	diagnosticsUsage = "error output format: text, json, plain, or auto (text on a terminal, plain otherwise)"
+	inlineUsage      = "use `source` given on the command line instead of a file"
+	engineUsage      = "execution engine: tree (tree-walking interpreter) or vm (bytecode virtual machine)"
+	traceExecUsage   = "print the VM stack and each instruction to stderr as it executes (implies -engine=vm)"
+	noOptUsage       = "run the program as written, without folding constants or removing dead branches"
 )
 
 func main() {
-	if len(os.Args) > 2 {
-		fmt.Println("Usage: tree [script]")
-		os.Exit(65)
-	} else if len(os.Args) == 2 {
-		fmt.Println("Running file: " + os.Args[1])
-		runFile(os.Args[1])
-	} else {
-		runPrompt()
-	}
+	flag.Usage = usage
+	flag.Parse()
+	os.Exit(runCommand(flag.Args()))
 }
 
-func runFile(filename string) {
-	bytes, err := os.ReadFile(filename)
-	if err != nil {
-		panic(err)
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: tree [flags] [script]")
+	fmt.Fprintln(out, "       tree <command> [flags] [script]")
+	fmt.Fprintln(out, "\nWith no script and no -e, tree starts an interactive prompt.")
+	fmt.Fprintln(out, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", c.name, c.summary)
 	}
-	run(string(bytes))
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
 }
 
-func runPrompt() {
-	input := bufio.NewScanner(os.Stdin)
-	for {
-		fmt.Print("> ")
-		if !input.Scan() {
-			break
+// checkDiagnosticsFormat validates --diagnostics and resolves "auto".
+func checkDiagnosticsFormat() bool {
+	switch *diagnosticsFormat {
+	case "auto":
+		if isTerminal(os.Stderr) {
+			*diagnosticsFormat = "text"
+		} else {
+			*diagnosticsFormat = "plain"
 		}
-		line := input.Text()
-		run(line)
-	}
-	if err := input.Err(); err != nil {
-		fmt.Fprintln(os.Stderr, "reading standard input:", err)
+	case "text", "json", "plain":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown diagnostics format %q.\n", *diagnosticsFormat)
+		return false
 	}
+	return true
 }
 
-func run(source string) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Fprintln(os.Stderr, "Error:", r)
-		}
-	}()
+// checkEngine validates --engine.
+func checkEngine() bool {
+	switch *engine {
+	case "tree", "vm":
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "Unknown engine %q.\n", *engine)
+	return false
+}
 
+// run executes source and returns the process exit code. All scan and parse
+// errors are reported together, as the reference implementation does.
+func run(filename string, source string) int {
 	// Step 1: Scan the source code into tokens
-	tokens := scanner.ScanTokens(source)
+	tokens, scanErrors := scanner.ScanTokens(source)
 
-	// Step 2: Parse the tokens into an AST
-	expression, err := parser.Parse(tokens)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Parse error:", err)
-		return
+	// Step 2: Parse the tokens into a list of statements
+	statements, ranges, err := parser.ParseProgramWithRanges(tokens)
+	if len(scanErrors) > 0 || err != nil {
+		reportErrors(filename, source, errors.Join(append(scanErrors, err)...))
+		return exitDataErr
+	}
+	if *engine == "vm" || *traceExec {
+		return runVM(filename, source, statements, ranges)
 	}
 
-	// Step 3: Interpret the AST
+	// Step 3: Resolve variable bindings
 	interp := interpreter.NewInterpreter()
-	result, err := interp.Interpret(expression)
+	if err := resolver.NewResolver(interp).Resolve(statements); err != nil {
+		reportErrors(filename, source, err)
+		return exitDataErr
+	}
+
+	// Step 4: Fold constants and remove dead branches
+	statements, err = optimize(statements)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Interpretation error:", err)
-		return
+		reportErrors(filename, source, err)
+		return exitDataErr
 	}
 
-	// Step 4: Print the result
-	fmt.Println(result)
+	// Step 5: Execute the program
+	if err := interp.Execute(statements); err != nil {
+		reportErrors(filename, source, err)
+		return exitSoftware
+	}
+	return 0
+}
+
+// runVM compiles a parsed program to bytecode and runs it on the virtual
+// machine, returning the process exit code.
+func runVM(filename string, source string, statements []parser.Stmt, ranges map[parser.Stmt]parser.Range) int {
+	function, ok := compileProgram(filename, source, statements, ranges)
+	if !ok {
+		return exitDataErr
+	}
+	return execute(filename, source, function)
+}
+
+// runCompiled loads a script compiled with "tree compile" and runs it on the
+// virtual machine. Its source is not available, so errors show line numbers
+// only.
+func runCompiled(filename string, data string) int {
+	function, err := vm.Load(strings.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+		return exitDataErr
+	}
+	return execute(filename, "", function)
+}
+
+// execute runs a compiled script on a new virtual machine.
+func execute(filename string, source string, function *vm.Function) int {
+	machine := vm.New()
+	if *traceExec {
+		machine.SetTrace(os.Stderr)
+	}
+	if err := machine.Interpret(function); err != nil {
+		reportErrors(filename, source, err)
+		return exitSoftware
+	}
+	return 0
+}
+
+// compileProgram checks a parsed program and compiles it to bytecode,
+// reporting any errors.
+func compileProgram(filename string, source string, statements []parser.Stmt, ranges map[parser.Stmt]parser.Range) (*vm.Function, bool) {
+	// The VM resolves variables itself; the resolver only reports static
+	// errors here.
+	if err := resolver.NewResolver(nil).Resolve(statements); err != nil {
+		reportErrors(filename, source, err)
+		return nil, false
+	}
+	statements, err := optimize(statements)
+	if err != nil {
+		reportErrors(filename, source, err)
+		return nil, false
+	}
+
+	function, err := vm.Compile(statements, ranges)
+	if err != nil {
+		reportErrors(filename, source, err)
+		return nil, false
+	}
+	return function, true
+}
+
+// optimize folds constants and removes dead branches from a resolved
+// program, unless --no-opt was given.
+func optimize(statements []parser.Stmt) ([]parser.Stmt, error) {
+	if *noOpt {
+		return statements, nil
+	}
+	return optimizer.NewOptimizer().Optimize(statements)
 }
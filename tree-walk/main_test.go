@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/interpreter"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/optimizer"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/resolver"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/vm"
+)
+
+func TestWritePlain_CompileErrors(t *testing.T) {
+	source := "foo(a | b);\nprint"
+
+	tokens, scanErrors := scanner.ScanTokens(source)
+	_, err := parser.ParseProgram(tokens)
+
+	var out strings.Builder
+	writePlain(&out, errors.Join(append(scanErrors, err)...))
+
+	expected := `[line 1] Error: Unexpected character.
+[line 1] Error at 'b': Expect ')' after arguments.
+[line 2] Error at end: Expect expression.
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestWritePlain_OptimizerError(t *testing.T) {
+	tokens, _ := scanner.ScanTokens("print 1;\nprint 2 / (1 - 1);")
+	statements, err := parser.ParseProgram(tokens)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	var out strings.Builder
+	_, err = optimizer.NewOptimizer().Optimize(statements)
+	writePlain(&out, err)
+
+	expected := "[line 2] Error at '/': Division by zero.\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestWritePlain_RuntimeError(t *testing.T) {
+	source := "var a = 1;\nprint a - \"b\";"
+
+	tokens, _ := scanner.ScanTokens(source)
+	statements, err := parser.ParseProgram(tokens)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	interp := interpreter.NewInterpreter()
+	if err := resolver.NewResolver(interp).Resolve(statements); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+
+	var out strings.Builder
+	writePlain(&out, interp.Execute(statements))
+
+	expected := "Operands must be numbers.\n[line 2]\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestWriteText_RuntimeErrorTraceback(t *testing.T) {
+	source := "fun f() {\n  return nil + 1;\n}\nf();"
+
+	tokens, _ := scanner.ScanTokens(source)
+	statements, ranges, err := parser.ParseProgramWithRanges(tokens)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	interp := interpreter.NewInterpreter()
+	if err := resolver.NewResolver(interp).Resolve(statements); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+	function, err := vm.Compile(statements, ranges)
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+
+	errs := map[string]error{
+		"tree": interp.Execute(statements),
+		"vm":   vm.New().Interpret(function),
+	}
+	for engine, runErr := range errs {
+		out, err := os.CreateTemp(t.TempDir(), "stderr")
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeText(out, source, runErr)
+		out.Close()
+		got, err := os.ReadFile(out.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := "Traceback (most recent call first):\n  [line 2] in f()\n  [line 4] in script\n"
+		if !strings.HasSuffix(string(got), expected) {
+			t.Errorf("Engine: %s\nExpected output ending with:\n%s\nGot:\n%s", engine, expected, got)
+		}
+	}
+}
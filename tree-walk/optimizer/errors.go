@@ -0,0 +1,25 @@
+package optimizer
+
+import (
+	"fmt"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+)
+
+// Error is an operation on constants that the optimizer found would always
+// fail at runtime.
+type Error struct {
+	Code    diagnostics.Code
+	Token   scanner.Token
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("[line %d, column %d] Error at '%s': %s", e.Token.Line, e.Token.Column, e.Token.Lexeme, e.Message)
+}
+
+// Diagnostic describes the error as pointing at the offending operator.
+func (e *Error) Diagnostic() diagnostics.Diagnostic {
+	return diagnostics.Diagnostic{Severity: diagnostics.Error, Code: e.Code, Span: e.Token.Span(), Message: e.Message}
+}
@@ -0,0 +1,281 @@
+// Package optimizer rewrites a resolved program into a simpler equivalent
+// before it runs: operators applied to literals are folded into a single
+// literal, parentheses are dropped, and if statements with a constant
+// condition are replaced by the branch that would run. Operations on
+// constants that would always fail, such as dividing by zero, are reported
+// as errors.
+package optimizer
+
+import (
+	"errors"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+// Optimizer is an AST pass that folds constant expressions and removes dead
+// branches. It rewrites the tree in place, keeping every variable, call and
+// statement it does not remove, so bindings recorded by the resolver and
+// statement ranges from the parser stay valid.
+type Optimizer struct {
+	errors []error
+}
+
+// NewOptimizer creates an optimizer.
+func NewOptimizer() *Optimizer {
+	return &Optimizer{}
+}
+
+// Optimize returns the optimized statements along with every error found.
+func (o *Optimizer) Optimize(statements []parser.Stmt) ([]parser.Stmt, error) {
+	o.errors = nil
+	statements = o.optimizeStatements(statements)
+	return statements, errors.Join(o.errors...)
+}
+
+// optimizeStatements optimizes a statement list, dropping removed
+// statements.
+func (o *Optimizer) optimizeStatements(statements []parser.Stmt) []parser.Stmt {
+	optimized := statements[:0]
+	for _, stmt := range statements {
+		if stmt = o.optimizeStmt(stmt); stmt != nil {
+			optimized = append(optimized, stmt)
+		}
+	}
+	return optimized
+}
+
+// optimizeStmt returns the replacement for stmt, or nil if it was removed.
+func (o *Optimizer) optimizeStmt(stmt parser.Stmt) parser.Stmt {
+	result, _ := stmt.Accept(o)
+	optimized, _ := result.(parser.Stmt)
+	return optimized
+}
+
+// optimizeBody optimizes a statement that cannot be removed, such as a loop
+// body, replacing it with an empty block if it has no effect.
+func (o *Optimizer) optimizeBody(stmt parser.Stmt) parser.Stmt {
+	if optimized := o.optimizeStmt(stmt); optimized != nil {
+		return optimized
+	}
+	return &parser.BlockStmt{}
+}
+
+func (o *Optimizer) optimizeExpr(expr parser.Expr) parser.Expr {
+	result, _ := expr.Accept(o)
+	return result.(parser.Expr)
+}
+
+func (o *Optimizer) error(token scanner.Token, code diagnostics.Code, message string) {
+	o.errors = append(o.errors, &Error{Code: code, Token: token, Message: message})
+}
+
+// Statements
+
+func (o *Optimizer) VisitBlockStmt(stmt *parser.BlockStmt) (interface{}, error) {
+	stmt.Statements = o.optimizeStatements(stmt.Statements)
+	return stmt, nil
+}
+
+func (o *Optimizer) VisitClassStmt(stmt *parser.ClassStmt) (interface{}, error) {
+	for _, method := range stmt.Methods {
+		o.VisitFunctionStmt(method)
+	}
+	return stmt, nil
+}
+
+func (o *Optimizer) VisitVarStmt(stmt *parser.VarStmt) (interface{}, error) {
+	if stmt.Initializer != nil {
+		stmt.Initializer = o.optimizeExpr(stmt.Initializer)
+	}
+	return stmt, nil
+}
+
+func (o *Optimizer) VisitFunctionStmt(stmt *parser.FunctionStmt) (interface{}, error) {
+	stmt.Body = o.optimizeStatements(stmt.Body)
+	return stmt, nil
+}
+
+func (o *Optimizer) VisitExpressionStmt(stmt *parser.ExpressionStmt) (interface{}, error) {
+	stmt.Expression = o.optimizeExpr(stmt.Expression)
+	return stmt, nil
+}
+
+// VisitIfStmt replaces an if statement whose condition is a constant with
+// the branch it selects, or removes it when there is no such branch. The
+// branch not taken is dropped without being optimized, so it reports no
+// errors.
+func (o *Optimizer) VisitIfStmt(stmt *parser.IfStmt) (interface{}, error) {
+	stmt.Condition = o.optimizeExpr(stmt.Condition)
+	if literal, ok := stmt.Condition.(*parser.LiteralExpr); ok {
+		branch := stmt.ElseBranch
+		if literal.Value.Truthy() {
+			branch = stmt.ThenBranch
+		}
+		if branch == nil {
+			return nil, nil
+		}
+		return o.optimizeStmt(branch), nil
+	}
+
+	stmt.ThenBranch = o.optimizeBody(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		stmt.ElseBranch = o.optimizeStmt(stmt.ElseBranch)
+	}
+	return stmt, nil
+}
+
+func (o *Optimizer) VisitPrintStmt(stmt *parser.PrintStmt) (interface{}, error) {
+	stmt.Expression = o.optimizeExpr(stmt.Expression)
+	return stmt, nil
+}
+
+func (o *Optimizer) VisitReturnStmt(stmt *parser.ReturnStmt) (interface{}, error) {
+	if stmt.Value != nil {
+		stmt.Value = o.optimizeExpr(stmt.Value)
+	}
+	return stmt, nil
+}
+
+func (o *Optimizer) VisitWhileStmt(stmt *parser.WhileStmt) (interface{}, error) {
+	stmt.Condition = o.optimizeExpr(stmt.Condition)
+	stmt.Body = o.optimizeBody(stmt.Body)
+	return stmt, nil
+}
+
+// Expressions
+
+func (o *Optimizer) VisitVariableExpr(expr *parser.VariableExpr) (interface{}, error) {
+	return expr, nil
+}
+
+func (o *Optimizer) VisitAssignExpr(expr *parser.AssignExpr) (interface{}, error) {
+	expr.Value = o.optimizeExpr(expr.Value)
+	return expr, nil
+}
+
+// VisitBinaryExpr folds an operator applied to two literals. Operands of the
+// wrong type are left for the runtime to report.
+func (o *Optimizer) VisitBinaryExpr(expr *parser.BinaryExpr) (interface{}, error) {
+	expr.Left = o.optimizeExpr(expr.Left)
+	expr.Right = o.optimizeExpr(expr.Right)
+
+	left, ok := expr.Left.(*parser.LiteralExpr)
+	if !ok {
+		return expr, nil
+	}
+	right, ok := expr.Right.(*parser.LiteralExpr)
+	if !ok {
+		return expr, nil
+	}
+	if result, ok := o.fold(expr.Operator, left.Value, right.Value); ok {
+		return &parser.LiteralExpr{Value: result}, nil
+	}
+	return expr, nil
+}
+
+// fold evaluates a binary operator on constants, reporting false if the
+// operation cannot be done at compile time.
+func (o *Optimizer) fold(operator scanner.Token, a, b value.Value) (value.Value, bool) {
+	switch operator.Type {
+	case scanner.EQUAL_EQUAL:
+		return value.Bool(a.Equal(b)), true
+	case scanner.BANG_EQUAL:
+		return value.Bool(!a.Equal(b)), true
+	case scanner.PLUS:
+		if aStr, ok := a.AsString(); ok {
+			if bStr, ok := b.AsString(); ok {
+				return value.String(aStr + bStr), true
+			}
+		}
+	}
+
+	if !a.IsNumber() || !b.IsNumber() {
+		return value.Nil, false
+	}
+	x, y := a.AsNumber(), b.AsNumber()
+	switch operator.Type {
+	case scanner.PLUS:
+		return value.Number(x + y), true
+	case scanner.MINUS:
+		return value.Number(x - y), true
+	case scanner.STAR:
+		return value.Number(x * y), true
+	case scanner.SLASH:
+		if y == 0 {
+			o.error(operator, diagnostics.ConstantDivisionByZero, "Division by zero.")
+			return value.Nil, false
+		}
+		return value.Number(x / y), true
+	case scanner.GREATER:
+		return value.Bool(x > y), true
+	case scanner.GREATER_EQUAL:
+		return value.Bool(x >= y), true
+	case scanner.LESS:
+		return value.Bool(x < y), true
+	case scanner.LESS_EQUAL:
+		return value.Bool(x <= y), true
+	}
+	return value.Nil, false
+}
+
+func (o *Optimizer) VisitCallExpr(expr *parser.CallExpr) (interface{}, error) {
+	expr.Callee = o.optimizeExpr(expr.Callee)
+	for i, argument := range expr.Arguments {
+		expr.Arguments[i] = o.optimizeExpr(argument)
+	}
+	return expr, nil
+}
+
+func (o *Optimizer) VisitGetExpr(expr *parser.GetExpr) (interface{}, error) {
+	expr.Object = o.optimizeExpr(expr.Object)
+	return expr, nil
+}
+
+func (o *Optimizer) VisitSetExpr(expr *parser.SetExpr) (interface{}, error) {
+	expr.Object = o.optimizeExpr(expr.Object)
+	expr.Value = o.optimizeExpr(expr.Value)
+	return expr, nil
+}
+
+func (o *Optimizer) VisitSuperExpr(expr *parser.SuperExpr) (interface{}, error) {
+	return expr, nil
+}
+
+func (o *Optimizer) VisitThisExpr(expr *parser.ThisExpr) (interface{}, error) {
+	return expr, nil
+}
+
+// VisitGroupingExpr drops the parentheses, which only affect parsing.
+func (o *Optimizer) VisitGroupingExpr(expr *parser.GroupingExpr) (interface{}, error) {
+	return o.optimizeExpr(expr.Expression), nil
+}
+
+func (o *Optimizer) VisitLiteralExpr(expr *parser.LiteralExpr) (interface{}, error) {
+	return expr, nil
+}
+
+func (o *Optimizer) VisitLogicalExpr(expr *parser.LogicalExpr) (interface{}, error) {
+	expr.Left = o.optimizeExpr(expr.Left)
+	expr.Right = o.optimizeExpr(expr.Right)
+	return expr, nil
+}
+
+// VisitUnaryExpr folds "!" on any literal and "-" on a number.
+func (o *Optimizer) VisitUnaryExpr(expr *parser.UnaryExpr) (interface{}, error) {
+	expr.Right = o.optimizeExpr(expr.Right)
+
+	literal, ok := expr.Right.(*parser.LiteralExpr)
+	if !ok {
+		return expr, nil
+	}
+	switch {
+	case expr.Operator.Type == scanner.BANG:
+		return &parser.LiteralExpr{Value: value.Bool(!literal.Value.Truthy())}, nil
+	case expr.Operator.Type == scanner.MINUS && literal.Value.IsNumber():
+		return &parser.LiteralExpr{Value: value.Number(-literal.Value.AsNumber())}, nil
+	}
+	return expr, nil
+}
@@ -0,0 +1,179 @@
+package optimizer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/interpreter"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/resolver"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+)
+
+func TestOptimizer_Optimize(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"print (1 + 2) * 3;", "(print 9)"},
+		{"print 10 - 4 / 2;", "(print 8)"},
+		{"print -(2 * 3);", "(print -6)"},
+		{`print "foo" + "bar";`, "(print foobar)"},
+		{"print 1 < 2;", "(print true)"},
+		{"print 2 >= 3;", "(print false)"},
+		{`print "a" == "a";`, "(print true)"},
+		{"print nil != false;", "(print true)"},
+		{"print !nil;", "(print true)"},
+		{"print !!0;", "(print true)"},
+		{"print (a);", "(print a)"},
+		{"print ((a + 1)) * (2 + 3);", "(print (* (+ a 1) 5))"},
+		{"f((1 + 1), (x));", "(; (call f 2 x))"},
+		{"a = (1 + 2);", "(; (= a 3))"},
+		{"var v = -(-1);", "(var v 1)"},
+		// Operands of the wrong type are left for the runtime to report.
+		{`print "a" - 1;`, "(print (- a 1))"},
+		{`print 1 + "a";`, "(print (+ 1 a))"},
+		{`print -"a";`, "(print (- a))"},
+		{`print "a" < "b";`, "(print (< a b))"},
+		{"print a + 1 + 2;", "(print (+ (+ a 1) 2))"},
+		{"print a and (1 + 1);", "(print (and a 2))"},
+
+		// Dead branches.
+		{"if (false) print 1;", ""},
+		{"if (nil) print 1; else print 2;", "(print 2)"},
+		{"if (1 > 2) print 1; else { print 2; }", "(block (print 2))"},
+		{"if (true) print 1; else print 2;", "(print 1)"},
+		{`if ("") print 1;`, "(print 1)"},
+		{"if (!true) print 1; print 2;", "(print 2)"},
+		{"{ if (false) print 1; print 2; }", "(block (print 2))"},
+		{"while (a) if (false) print 1;", "(while a (block))"},
+		{"if (a) if (false) print 1;", "(if a (block))"},
+		{"if (a) print 1; else if (false) print 2;", "(if a (print 1))"},
+		{"if (a) print 1 + 1;", "(if a (print 2))"},
+		{"fun f() { if (false) return 1; return 2 * 2; }", "(fun f (params) (return 4))"},
+		{"class C { m() { return (this); } }", "(class C (fun m (params) (return this)))"},
+	}
+
+	for _, tt := range tests {
+		statements, err := NewOptimizer().Optimize(parse(t, tt.source))
+		if err != nil {
+			t.Errorf("Source: %s\nUnexpected error: %v", tt.source, err)
+			continue
+		}
+		if got := printProgram(t, statements); got != tt.expected {
+			t.Errorf("Source: %s\nExpected: %s\nGot: %s", tt.source, tt.expected, got)
+		}
+	}
+}
+
+func TestOptimizer_Errors(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected []string
+	}{
+		{"print 1 / 0;", []string{"[line 1, column 9] Error at '/': Division by zero."}},
+		{"print (2 - 2) / 0;\nprint 3 / (1 - 1);", []string{
+			"[line 1, column 15] Error at '/': Division by zero.",
+			"[line 2, column 9] Error at '/': Division by zero.",
+		}},
+		{"fun f() { return 1 / 0; }", []string{"[line 1, column 20] Error at '/': Division by zero."}},
+	}
+
+	for _, tt := range tests {
+		_, err := NewOptimizer().Optimize(parse(t, tt.source))
+		if err == nil {
+			t.Errorf("Source: %s\nExpected errors, got none", tt.source)
+			continue
+		}
+		got := strings.Split(err.Error(), "\n")
+		if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("Source: %s\nExpected: %q\nGot: %q", tt.source, tt.expected, got)
+		}
+		var optErr *Error
+		if !errors.As(err, &optErr) || optErr.Diagnostic().Code != diagnostics.ConstantDivisionByZero {
+			t.Errorf("Source: %s\nExpected an *Error with code %s, got %#v", tt.source, diagnostics.ConstantDivisionByZero, err)
+		}
+	}
+}
+
+func TestOptimizer_DeadBranchesReportNoErrors(t *testing.T) {
+	for _, source := range []string{
+		"if (false) print 1 / 0;",
+		"if (true) print 1; else print 1 / 0;",
+		"print 1 / a;",
+	} {
+		if _, err := NewOptimizer().Optimize(parse(t, source)); err != nil {
+			t.Errorf("Source: %s\nUnexpected error: %v", source, err)
+		}
+	}
+}
+
+// TestOptimizer_PreservesBehavior runs programs before and after optimizing
+// them, after resolving, as the interpreter does.
+func TestOptimizer_PreservesBehavior(t *testing.T) {
+	programs := []string{
+		`var a = "x"; { var a = (1 + 2) * 3; if (a > 8) print a + 1; else print "no"; } print a;`,
+		`fun f(n) { if (true) { var m = (n); return m * (2 + 2); } } print f(3);`,
+		`var i = 0; while (i < (1 + 2)) { if (!false) print i; i = i + 1; }`,
+		`for (var i = 0; i < 2; i = i + (1 * 1)) { if (false) print "dead"; print i; }`,
+		`class A { m() { return "a" + "b"; } } class B < A { m() { return (super.m)() + this.n; } } var b = B(); b.n = "c" + "d"; print b.m(); b.n = -(-1); print b.n;`,
+		`fun counter() { var c = 0; fun inc() { c = c + (1); return c; } return inc; } var f = counter(); f(); print f();`,
+	}
+
+	for _, source := range programs {
+		expected := execute(t, source, false)
+		if got := execute(t, source, true); got != expected {
+			t.Errorf("Source: %s\nExpected: %q\nGot: %q", source, expected, got)
+		}
+	}
+}
+
+func execute(t *testing.T, source string, optimize bool) string {
+	t.Helper()
+	statements := parse(t, source)
+	interp := interpreter.NewInterpreter()
+	var out strings.Builder
+	interp.SetOutput(&out)
+	if err := resolver.NewResolver(interp).Resolve(statements); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+	if optimize {
+		var err error
+		if statements, err = NewOptimizer().Optimize(statements); err != nil {
+			t.Fatalf("Optimize error: %v", err)
+		}
+	}
+	if err := interp.Execute(statements); err != nil {
+		t.Fatalf("Runtime error: %v", err)
+	}
+	return out.String()
+}
+
+func printProgram(t *testing.T, statements []parser.Stmt) string {
+	t.Helper()
+	printer := &parser.AstPrinter{}
+	lines := make([]string, len(statements))
+	for i, stmt := range statements {
+		s, err := printer.PrintStmt(stmt)
+		if err != nil {
+			t.Fatalf("Print error: %v", err)
+		}
+		lines[i] = s
+	}
+	return strings.Join(lines, "\n")
+}
+
+func parse(t *testing.T, source string) []parser.Stmt {
+	t.Helper()
+	tokens, errs := scanner.ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Scan errors for source: %s\nErrors: %v", source, errs)
+	}
+	statements, err := parser.ParseProgram(tokens)
+	if err != nil {
+		t.Fatalf("Parse error for source: %s\nError: %v", source, err)
+	}
+	return statements
+}
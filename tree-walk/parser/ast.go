@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
 )
 
 // Expr is the interface for all expression nodes.
@@ -17,6 +18,14 @@ type ExprVisitor interface {
 	VisitUnaryExpr(expr *UnaryExpr) (interface{}, error)
 	VisitLiteralExpr(expr *LiteralExpr) (interface{}, error)
 	VisitGroupingExpr(expr *GroupingExpr) (interface{}, error)
+	VisitVariableExpr(expr *VariableExpr) (interface{}, error)
+	VisitAssignExpr(expr *AssignExpr) (interface{}, error)
+	VisitLogicalExpr(expr *LogicalExpr) (interface{}, error)
+	VisitCallExpr(expr *CallExpr) (interface{}, error)
+	VisitGetExpr(expr *GetExpr) (interface{}, error)
+	VisitSetExpr(expr *SetExpr) (interface{}, error)
+	VisitThisExpr(expr *ThisExpr) (interface{}, error)
+	VisitSuperExpr(expr *SuperExpr) (interface{}, error)
 }
 
 // BinaryExpr represents binary operations (e.g., addition, subtraction).
@@ -42,7 +51,7 @@ func (expr *UnaryExpr) Accept(visitor ExprVisitor) (interface{}, error) {
 
 // LiteralExpr represents literal values like numbers and strings.
 type LiteralExpr struct {
-	Value interface{}
+	Value value.Value
 }
 
 func (expr *LiteralExpr) Accept(visitor ExprVisitor) (interface{}, error) {
@@ -58,6 +67,210 @@ func (expr *GroupingExpr) Accept(visitor ExprVisitor) (interface{}, error) {
 	return visitor.VisitGroupingExpr(expr)
 }
 
+// VariableExpr represents a reference to a variable by name.
+type VariableExpr struct {
+	Name scanner.Token
+}
+
+func (expr *VariableExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitVariableExpr(expr)
+}
+
+// AssignExpr represents assigning a new value to an existing variable.
+type AssignExpr struct {
+	Name  scanner.Token
+	Value Expr
+}
+
+func (expr *AssignExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitAssignExpr(expr)
+}
+
+// LogicalExpr represents the short-circuiting "and" and "or" operators.
+type LogicalExpr struct {
+	Left     Expr
+	Operator scanner.Token
+	Right    Expr
+}
+
+func (expr *LogicalExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitLogicalExpr(expr)
+}
+
+// CallExpr represents a call. Paren is the closing parenthesis, used to
+// report errors raised by the call.
+type CallExpr struct {
+	Callee    Expr
+	Paren     scanner.Token
+	Arguments []Expr
+}
+
+func (expr *CallExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitCallExpr(expr)
+}
+
+// GetExpr represents reading a property from an instance.
+type GetExpr struct {
+	Object Expr
+	Name   scanner.Token
+}
+
+func (expr *GetExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitGetExpr(expr)
+}
+
+// SetExpr represents assigning to a field of an instance.
+type SetExpr struct {
+	Object Expr
+	Name   scanner.Token
+	Value  Expr
+}
+
+func (expr *SetExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitSetExpr(expr)
+}
+
+// ThisExpr represents the "this" keyword inside a method.
+type ThisExpr struct {
+	Keyword scanner.Token
+}
+
+func (expr *ThisExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitThisExpr(expr)
+}
+
+// SuperExpr represents a superclass method access such as "super.method".
+type SuperExpr struct {
+	Keyword scanner.Token
+	Method  scanner.Token
+}
+
+func (expr *SuperExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitSuperExpr(expr)
+}
+
+// Stmt is the interface for all statement nodes.
+type Stmt interface {
+	Accept(visitor StmtVisitor) (interface{}, error)
+}
+
+// StmtVisitor defines methods for visiting each statement type.
+type StmtVisitor interface {
+	VisitExpressionStmt(stmt *ExpressionStmt) (interface{}, error)
+	VisitPrintStmt(stmt *PrintStmt) (interface{}, error)
+	VisitVarStmt(stmt *VarStmt) (interface{}, error)
+	VisitBlockStmt(stmt *BlockStmt) (interface{}, error)
+	VisitIfStmt(stmt *IfStmt) (interface{}, error)
+	VisitWhileStmt(stmt *WhileStmt) (interface{}, error)
+	VisitFunctionStmt(stmt *FunctionStmt) (interface{}, error)
+	VisitReturnStmt(stmt *ReturnStmt) (interface{}, error)
+	VisitClassStmt(stmt *ClassStmt) (interface{}, error)
+}
+
+// ExpressionStmt represents an expression evaluated for its side effects.
+type ExpressionStmt struct {
+	Expression Expr
+}
+
+func (stmt *ExpressionStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitExpressionStmt(stmt)
+}
+
+// PrintStmt represents a print statement.
+type PrintStmt struct {
+	Expression Expr
+}
+
+func (stmt *PrintStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitPrintStmt(stmt)
+}
+
+// VarStmt represents a variable declaration with an optional initializer.
+type VarStmt struct {
+	Name        scanner.Token
+	Initializer Expr
+}
+
+func (stmt *VarStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitVarStmt(stmt)
+}
+
+// BlockStmt represents a braced list of statements with its own scope.
+type BlockStmt struct {
+	Statements []Stmt
+}
+
+func (stmt *BlockStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitBlockStmt(stmt)
+}
+
+// IfStmt represents a conditional with an optional else branch.
+type IfStmt struct {
+	Condition  Expr
+	ThenBranch Stmt
+	ElseBranch Stmt
+}
+
+func (stmt *IfStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitIfStmt(stmt)
+}
+
+// WhileStmt represents a loop. "for" loops are desugared into it; For is
+// set on loops that were written as one.
+type WhileStmt struct {
+	Condition Expr
+	Body      Stmt
+	For       *ForLoop
+}
+
+func (stmt *WhileStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitWhileStmt(stmt)
+}
+
+// ForLoop records which clauses a desugared "for" loop had, so tools such as
+// the formatter can print it in its original form. When Initializer is set
+// the loop is the second statement of a block whose first statement is the
+// initializer; when Increment is set the body is a block whose second
+// statement evaluates the increment.
+type ForLoop struct {
+	Initializer bool
+	Condition   bool
+	Increment   bool
+}
+
+// FunctionStmt represents a named function declaration.
+type FunctionStmt struct {
+	Name   scanner.Token
+	Params []scanner.Token
+	Body   []Stmt
+}
+
+func (stmt *FunctionStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitFunctionStmt(stmt)
+}
+
+// ReturnStmt represents a return from a function with an optional value.
+type ReturnStmt struct {
+	Keyword scanner.Token
+	Value   Expr
+}
+
+func (stmt *ReturnStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitReturnStmt(stmt)
+}
+
+// ClassStmt represents a class declaration and its methods. Superclass is
+// nil when the class does not inherit from another class.
+type ClassStmt struct {
+	Name       scanner.Token
+	Superclass *VariableExpr
+	Methods    []*FunctionStmt
+}
+
+func (stmt *ClassStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitClassStmt(stmt)
+}
+
 // AstPrinter is used for generating a string representation of the AST.
 type AstPrinter struct{}
 
@@ -70,6 +283,15 @@ func (a *AstPrinter) Print(expr Expr) (string, error) {
 	return result.(string), nil
 }
 
+// PrintStmt returns the string representation of the statement.
+func (a *AstPrinter) PrintStmt(stmt Stmt) (string, error) {
+	result, err := stmt.Accept(a)
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
+
 // Visitor methods for AstPrinter.
 
 func (a *AstPrinter) VisitBinaryExpr(expr *BinaryExpr) (interface{}, error) {
@@ -93,10 +315,10 @@ func (a *AstPrinter) VisitGroupingExpr(expr *GroupingExpr) (interface{}, error)
 }
 
 func (a *AstPrinter) VisitLiteralExpr(expr *LiteralExpr) (interface{}, error) {
-	if expr.Value == nil {
+	if expr.Value.IsNil() {
 		return "nil", nil
 	}
-	return fmt.Sprintf("%v", expr.Value), nil
+	return fmt.Sprintf("%v", expr.Value.Interface()), nil
 }
 
 func (a *AstPrinter) VisitUnaryExpr(expr *UnaryExpr) (interface{}, error) {
@@ -107,6 +329,186 @@ func (a *AstPrinter) VisitUnaryExpr(expr *UnaryExpr) (interface{}, error) {
 	return a.parenthesize(expr.Operator.Lexeme, rightStr.(string)), nil
 }
 
+func (a *AstPrinter) VisitVariableExpr(expr *VariableExpr) (interface{}, error) {
+	return expr.Name.Lexeme, nil
+}
+
+func (a *AstPrinter) VisitAssignExpr(expr *AssignExpr) (interface{}, error) {
+	valueStr, err := expr.Value.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	return a.parenthesize("= "+expr.Name.Lexeme, valueStr.(string)), nil
+}
+
+func (a *AstPrinter) VisitLogicalExpr(expr *LogicalExpr) (interface{}, error) {
+	leftStr, err := expr.Left.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	rightStr, err := expr.Right.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	return a.parenthesize(expr.Operator.Lexeme, leftStr.(string), rightStr.(string)), nil
+}
+
+func (a *AstPrinter) VisitCallExpr(expr *CallExpr) (interface{}, error) {
+	calleeStr, err := expr.Callee.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, 0, len(expr.Arguments))
+	for _, argument := range expr.Arguments {
+		str, err := argument.Accept(a)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, str.(string))
+	}
+	return a.parenthesize("call "+calleeStr.(string), parts...), nil
+}
+
+func (a *AstPrinter) VisitGetExpr(expr *GetExpr) (interface{}, error) {
+	objectStr, err := expr.Object.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	return a.parenthesize(".", objectStr.(string), expr.Name.Lexeme), nil
+}
+
+func (a *AstPrinter) VisitSetExpr(expr *SetExpr) (interface{}, error) {
+	objectStr, err := expr.Object.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	valueStr, err := expr.Value.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	return a.parenthesize("=", objectStr.(string), expr.Name.Lexeme, valueStr.(string)), nil
+}
+
+func (a *AstPrinter) VisitThisExpr(expr *ThisExpr) (interface{}, error) {
+	return "this", nil
+}
+
+func (a *AstPrinter) VisitSuperExpr(expr *SuperExpr) (interface{}, error) {
+	return a.parenthesize("super", expr.Method.Lexeme), nil
+}
+
+func (a *AstPrinter) VisitExpressionStmt(stmt *ExpressionStmt) (interface{}, error) {
+	expressionStr, err := stmt.Expression.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	return a.parenthesize(";", expressionStr.(string)), nil
+}
+
+func (a *AstPrinter) VisitPrintStmt(stmt *PrintStmt) (interface{}, error) {
+	expressionStr, err := stmt.Expression.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	return a.parenthesize("print", expressionStr.(string)), nil
+}
+
+func (a *AstPrinter) VisitVarStmt(stmt *VarStmt) (interface{}, error) {
+	if stmt.Initializer == nil {
+		return a.parenthesize("var " + stmt.Name.Lexeme), nil
+	}
+	initializerStr, err := stmt.Initializer.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	return a.parenthesize("var "+stmt.Name.Lexeme, initializerStr.(string)), nil
+}
+
+func (a *AstPrinter) VisitBlockStmt(stmt *BlockStmt) (interface{}, error) {
+	parts := make([]string, 0, len(stmt.Statements))
+	for _, s := range stmt.Statements {
+		str, err := s.Accept(a)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, str.(string))
+	}
+	return a.parenthesize("block", parts...), nil
+}
+
+func (a *AstPrinter) VisitIfStmt(stmt *IfStmt) (interface{}, error) {
+	conditionStr, err := stmt.Condition.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	thenStr, err := stmt.ThenBranch.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.ElseBranch == nil {
+		return a.parenthesize("if", conditionStr.(string), thenStr.(string)), nil
+	}
+	elseStr, err := stmt.ElseBranch.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	return a.parenthesize("if", conditionStr.(string), thenStr.(string), elseStr.(string)), nil
+}
+
+func (a *AstPrinter) VisitWhileStmt(stmt *WhileStmt) (interface{}, error) {
+	conditionStr, err := stmt.Condition.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	bodyStr, err := stmt.Body.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	return a.parenthesize("while", conditionStr.(string), bodyStr.(string)), nil
+}
+
+func (a *AstPrinter) VisitFunctionStmt(stmt *FunctionStmt) (interface{}, error) {
+	params := make([]string, 0, len(stmt.Params))
+	for _, param := range stmt.Params {
+		params = append(params, param.Lexeme)
+	}
+	parts := []string{a.parenthesize("params", params...)}
+	for _, s := range stmt.Body {
+		str, err := s.Accept(a)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, str.(string))
+	}
+	return a.parenthesize("fun "+stmt.Name.Lexeme, parts...), nil
+}
+
+func (a *AstPrinter) VisitReturnStmt(stmt *ReturnStmt) (interface{}, error) {
+	if stmt.Value == nil {
+		return a.parenthesize("return"), nil
+	}
+	valueStr, err := stmt.Value.Accept(a)
+	if err != nil {
+		return nil, err
+	}
+	return a.parenthesize("return", valueStr.(string)), nil
+}
+
+func (a *AstPrinter) VisitClassStmt(stmt *ClassStmt) (interface{}, error) {
+	parts := make([]string, 0, len(stmt.Methods)+1)
+	if stmt.Superclass != nil {
+		parts = append(parts, "< "+stmt.Superclass.Name.Lexeme)
+	}
+	for _, method := range stmt.Methods {
+		str, err := method.Accept(a)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, str.(string))
+	}
+	return a.parenthesize("class "+stmt.Name.Lexeme, parts...), nil
+}
+
 // Helper method for AstPrinter.
 func (a *AstPrinter) parenthesize(name string, parts ...string) string {
 	var result string
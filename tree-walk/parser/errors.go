@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+)
+
+// Error is a single syntax error reported by the parser.
+type Error struct {
+	Code    diagnostics.Code
+	Token   scanner.Token
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Token.Type == scanner.EOF {
+		return fmt.Sprintf("[line %d, column %d] Error at end: %s", e.Token.Line, e.Token.Column, e.Message)
+	}
+	return fmt.Sprintf("[line %d, column %d] Error at '%s': %s", e.Token.Line, e.Token.Column, e.Token.Lexeme, e.Message)
+}
+
+// Diagnostic describes the error as pointing at the offending token.
+func (e *Error) Diagnostic() diagnostics.Diagnostic {
+	return diagnostics.Diagnostic{Severity: diagnostics.Error, Code: e.Code, Span: e.Token.Span(), Message: e.Message}
+}
+
+// ErrorList holds every syntax error found in a single parse, in source
+// order. It is the error type returned by Parse and ParseProgram.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Unwrap exposes the individual errors to errors.Is and errors.As.
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, err := range l {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Incomplete reports whether every error in the list was found at the end of
+// the input, meaning the source is a valid prefix that more input could
+// complete, such as an unclosed block or a statement missing its ';'.
+func (l ErrorList) Incomplete() bool {
+	if len(l) == 0 {
+		return false
+	}
+	for _, err := range l {
+		if err.Token.Type != scanner.EOF {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,564 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+// The JSON form of the AST is meant for golden tests and for tools outside
+// Go. Every node is an object whose "node" field names its type (Binary,
+// Print, Class, ...) and whose other fields mirror the Go struct, with nested
+// nodes inline, absent optional nodes as null and tokens as objects carrying
+// their position:
+//
+//	{"node":"Unary","operator":{"type":"MINUS","lexeme":"-","line":1,...},"right":{...}}
+
+// ExprToJSON encodes an expression.
+func ExprToJSON(expr Expr) ([]byte, error) {
+	node, err := encodeExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(node)
+}
+
+// ProgramToJSON encodes a list of statements as a JSON array.
+func ProgramToJSON(statements []Stmt) ([]byte, error) {
+	nodes, err := encodeStmts(statements)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(nodes)
+}
+
+// ExprFromJSON decodes an expression encoded by ExprToJSON.
+func ExprFromJSON(data []byte) (Expr, error) {
+	return decodeExpr(data)
+}
+
+// ProgramFromJSON decodes a list of statements encoded by ProgramToJSON.
+func ProgramFromJSON(data []byte) ([]Stmt, error) {
+	return decodeStmts(data)
+}
+
+// jsonNode is the encoded form of an Expr or Stmt. Its fields are written in
+// declaration order after "node", rather than sorted as a map's would be, so
+// the output reads like the source structure.
+type jsonNode struct {
+	kind   string
+	names  []string
+	values []interface{}
+}
+
+func (n *jsonNode) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	kind, _ := json.Marshal(n.kind)
+	b.WriteString(`{"node":`)
+	b.Write(kind)
+	for i, name := range n.names {
+		value, err := json.Marshal(n.values[i])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, ",%q:", name)
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// jsonToken is the encoded form of a scanner.Token.
+type jsonToken struct {
+	Type    string      `json:"type"`
+	Lexeme  string      `json:"lexeme"`
+	Literal interface{} `json:"literal,omitempty"`
+	Line    int         `json:"line"`
+	Column  int         `json:"column"`
+	Start   int         `json:"start"`
+	End     int         `json:"end"`
+}
+
+// jsonForLoop is the encoded form of a ForLoop.
+type jsonForLoop struct {
+	Initializer bool `json:"initializer"`
+	Condition   bool `json:"condition"`
+	Increment   bool `json:"increment"`
+}
+
+// jsonEncoder converts nodes to jsonNode values.
+type jsonEncoder struct{}
+
+func encodeExpr(expr Expr) (interface{}, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	return expr.Accept(jsonEncoder{})
+}
+
+func encodeStmt(stmt Stmt) (interface{}, error) {
+	if stmt == nil {
+		return nil, nil
+	}
+	return stmt.Accept(jsonEncoder{})
+}
+
+func encodeExprs(exprs []Expr) ([]interface{}, error) {
+	nodes := make([]interface{}, len(exprs))
+	for i, expr := range exprs {
+		node, err := encodeExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+func encodeStmts(statements []Stmt) ([]interface{}, error) {
+	nodes := make([]interface{}, len(statements))
+	for i, stmt := range statements {
+		node, err := encodeStmt(stmt)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+func encodeToken(token scanner.Token) jsonToken {
+	return jsonToken{
+		Type:    scanner.TokenTypeNames[token.Type],
+		Lexeme:  token.Lexeme,
+		Literal: token.Literal,
+		Line:    token.Line,
+		Column:  token.Column,
+		Start:   token.Start,
+		End:     token.End,
+	}
+}
+
+func encodeTokens(tokens []scanner.Token) []jsonToken {
+	encoded := make([]jsonToken, len(tokens))
+	for i, token := range tokens {
+		encoded[i] = encodeToken(token)
+	}
+	return encoded
+}
+
+// node builds a jsonNode of the given kind. fields alternates names and
+// values; Expr and Stmt values are encoded recursively.
+func (e jsonEncoder) node(kind string, fields ...interface{}) (interface{}, error) {
+	node := &jsonNode{kind: kind}
+	for i := 0; i < len(fields); i += 2 {
+		var value interface{}
+		var err error
+		switch v := fields[i+1].(type) {
+		case Expr:
+			value, err = encodeExpr(v)
+		case Stmt:
+			value, err = encodeStmt(v)
+		case scanner.Token:
+			value = encodeToken(v)
+		default:
+			value = v
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.names = append(node.names, fields[i].(string))
+		node.values = append(node.values, value)
+	}
+	return node, nil
+}
+
+func (e jsonEncoder) VisitBinaryExpr(expr *BinaryExpr) (interface{}, error) {
+	return e.node("Binary", "left", expr.Left, "operator", expr.Operator, "right", expr.Right)
+}
+
+func (e jsonEncoder) VisitGroupingExpr(expr *GroupingExpr) (interface{}, error) {
+	return e.node("Grouping", "expression", expr.Expression)
+}
+
+func (e jsonEncoder) VisitLiteralExpr(expr *LiteralExpr) (interface{}, error) {
+	return e.node("Literal", "value", expr.Value.Interface())
+}
+
+func (e jsonEncoder) VisitUnaryExpr(expr *UnaryExpr) (interface{}, error) {
+	return e.node("Unary", "operator", expr.Operator, "right", expr.Right)
+}
+
+func (e jsonEncoder) VisitVariableExpr(expr *VariableExpr) (interface{}, error) {
+	return e.node("Variable", "name", expr.Name)
+}
+
+func (e jsonEncoder) VisitAssignExpr(expr *AssignExpr) (interface{}, error) {
+	return e.node("Assign", "name", expr.Name, "value", expr.Value)
+}
+
+func (e jsonEncoder) VisitLogicalExpr(expr *LogicalExpr) (interface{}, error) {
+	return e.node("Logical", "left", expr.Left, "operator", expr.Operator, "right", expr.Right)
+}
+
+func (e jsonEncoder) VisitCallExpr(expr *CallExpr) (interface{}, error) {
+	arguments, err := encodeExprs(expr.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	return e.node("Call", "callee", expr.Callee, "paren", expr.Paren, "arguments", arguments)
+}
+
+func (e jsonEncoder) VisitGetExpr(expr *GetExpr) (interface{}, error) {
+	return e.node("Get", "object", expr.Object, "name", expr.Name)
+}
+
+func (e jsonEncoder) VisitSetExpr(expr *SetExpr) (interface{}, error) {
+	return e.node("Set", "object", expr.Object, "name", expr.Name, "value", expr.Value)
+}
+
+func (e jsonEncoder) VisitThisExpr(expr *ThisExpr) (interface{}, error) {
+	return e.node("This", "keyword", expr.Keyword)
+}
+
+func (e jsonEncoder) VisitSuperExpr(expr *SuperExpr) (interface{}, error) {
+	return e.node("Super", "keyword", expr.Keyword, "method", expr.Method)
+}
+
+func (e jsonEncoder) VisitExpressionStmt(stmt *ExpressionStmt) (interface{}, error) {
+	return e.node("Expression", "expression", stmt.Expression)
+}
+
+func (e jsonEncoder) VisitPrintStmt(stmt *PrintStmt) (interface{}, error) {
+	return e.node("Print", "expression", stmt.Expression)
+}
+
+func (e jsonEncoder) VisitVarStmt(stmt *VarStmt) (interface{}, error) {
+	return e.node("Var", "name", stmt.Name, "initializer", stmt.Initializer)
+}
+
+func (e jsonEncoder) VisitBlockStmt(stmt *BlockStmt) (interface{}, error) {
+	statements, err := encodeStmts(stmt.Statements)
+	if err != nil {
+		return nil, err
+	}
+	return e.node("Block", "statements", statements)
+}
+
+func (e jsonEncoder) VisitIfStmt(stmt *IfStmt) (interface{}, error) {
+	return e.node("If", "condition", stmt.Condition, "thenBranch", stmt.ThenBranch, "elseBranch", stmt.ElseBranch)
+}
+
+func (e jsonEncoder) VisitWhileStmt(stmt *WhileStmt) (interface{}, error) {
+	var loop *jsonForLoop
+	if stmt.For != nil {
+		loop = &jsonForLoop{Initializer: stmt.For.Initializer, Condition: stmt.For.Condition, Increment: stmt.For.Increment}
+	}
+	return e.node("While", "condition", stmt.Condition, "body", stmt.Body, "for", loop)
+}
+
+func (e jsonEncoder) VisitFunctionStmt(stmt *FunctionStmt) (interface{}, error) {
+	body, err := encodeStmts(stmt.Body)
+	if err != nil {
+		return nil, err
+	}
+	return e.node("Function", "name", stmt.Name, "params", encodeTokens(stmt.Params), "body", body)
+}
+
+func (e jsonEncoder) VisitReturnStmt(stmt *ReturnStmt) (interface{}, error) {
+	return e.node("Return", "keyword", stmt.Keyword, "value", stmt.Value)
+}
+
+func (e jsonEncoder) VisitClassStmt(stmt *ClassStmt) (interface{}, error) {
+	var superclass interface{}
+	if stmt.Superclass != nil {
+		var err error
+		if superclass, err = encodeExpr(stmt.Superclass); err != nil {
+			return nil, err
+		}
+	}
+	methods := make([]interface{}, len(stmt.Methods))
+	for i, method := range stmt.Methods {
+		node, err := encodeStmt(method)
+		if err != nil {
+			return nil, err
+		}
+		methods[i] = node
+	}
+	return e.node("Class", "name", stmt.Name, "superclass", superclass, "methods", methods)
+}
+
+// jsonFields is a node being decoded, with its fields still raw.
+type jsonFields map[string]json.RawMessage
+
+func decodeFields(data []byte) (jsonFields, string, error) {
+	if isNull(data) {
+		return nil, "", nil
+	}
+	var fields jsonFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, "", err
+	}
+	var kind string
+	if err := json.Unmarshal(fields["node"], &kind); err != nil {
+		return nil, "", fmt.Errorf("ast json: missing node type: %w", err)
+	}
+	return fields, kind, nil
+}
+
+func isNull(data []byte) bool {
+	return len(data) == 0 || string(data) == "null"
+}
+
+func decodeExpr(data []byte) (Expr, error) {
+	f, kind, err := decodeFields(data)
+	if err != nil || f == nil {
+		return nil, err
+	}
+
+	d := &jsonDecoder{fields: f}
+	var expr Expr
+	switch kind {
+	case "Binary":
+		expr = &BinaryExpr{Left: d.requiredExpr("left"), Operator: d.token("operator"), Right: d.requiredExpr("right")}
+	case "Grouping":
+		expr = &GroupingExpr{Expression: d.requiredExpr("expression")}
+	case "Literal":
+		expr = &LiteralExpr{Value: value.Of(d.value("value"))}
+	case "Unary":
+		expr = &UnaryExpr{Operator: d.token("operator"), Right: d.requiredExpr("right")}
+	case "Variable":
+		expr = &VariableExpr{Name: d.token("name")}
+	case "Assign":
+		expr = &AssignExpr{Name: d.token("name"), Value: d.requiredExpr("value")}
+	case "Logical":
+		expr = &LogicalExpr{Left: d.requiredExpr("left"), Operator: d.token("operator"), Right: d.requiredExpr("right")}
+	case "Call":
+		expr = &CallExpr{Callee: d.requiredExpr("callee"), Paren: d.token("paren"), Arguments: d.exprs("arguments")}
+	case "Get":
+		expr = &GetExpr{Object: d.requiredExpr("object"), Name: d.token("name")}
+	case "Set":
+		expr = &SetExpr{Object: d.requiredExpr("object"), Name: d.token("name"), Value: d.requiredExpr("value")}
+	case "This":
+		expr = &ThisExpr{Keyword: d.token("keyword")}
+	case "Super":
+		expr = &SuperExpr{Keyword: d.token("keyword"), Method: d.token("method")}
+	default:
+		return nil, fmt.Errorf("ast json: unknown expression node %q", kind)
+	}
+	return expr, d.err
+}
+
+func decodeStmt(data []byte) (Stmt, error) {
+	f, kind, err := decodeFields(data)
+	if err != nil || f == nil {
+		return nil, err
+	}
+
+	d := &jsonDecoder{fields: f}
+	var stmt Stmt
+	switch kind {
+	case "Expression":
+		stmt = &ExpressionStmt{Expression: d.requiredExpr("expression")}
+	case "Print":
+		stmt = &PrintStmt{Expression: d.requiredExpr("expression")}
+	case "Var":
+		stmt = &VarStmt{Name: d.token("name"), Initializer: d.expr("initializer")}
+	case "Block":
+		stmt = &BlockStmt{Statements: d.stmts("statements")}
+	case "If":
+		stmt = &IfStmt{Condition: d.requiredExpr("condition"), ThenBranch: d.requiredStmt("thenBranch"), ElseBranch: d.stmt("elseBranch")}
+	case "While":
+		stmt = &WhileStmt{Condition: d.requiredExpr("condition"), Body: d.requiredStmt("body"), For: d.forLoop("for")}
+	case "Function":
+		stmt = d.function()
+	case "Return":
+		stmt = &ReturnStmt{Keyword: d.token("keyword"), Value: d.expr("value")}
+	case "Class":
+		class := &ClassStmt{Name: d.token("name"), Methods: []*FunctionStmt{}}
+		if superclass := d.expr("superclass"); superclass != nil {
+			variable, ok := superclass.(*VariableExpr)
+			if !ok {
+				return nil, fmt.Errorf("ast json: superclass must be a Variable node")
+			}
+			class.Superclass = variable
+		}
+		for _, method := range d.stmts("methods") {
+			function, ok := method.(*FunctionStmt)
+			if !ok {
+				return nil, fmt.Errorf("ast json: class methods must be Function nodes")
+			}
+			class.Methods = append(class.Methods, function)
+		}
+		stmt = class
+	default:
+		return nil, fmt.Errorf("ast json: unknown statement node %q", kind)
+	}
+	return stmt, d.err
+}
+
+func decodeStmts(data []byte) ([]Stmt, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	statements := make([]Stmt, 0, len(raw))
+	for _, r := range raw {
+		stmt, err := decodeStmt(r)
+		if err != nil {
+			return nil, err
+		}
+		if stmt == nil {
+			return nil, fmt.Errorf("ast json: null statement")
+		}
+		statements = append(statements, stmt)
+	}
+	return statements, nil
+}
+
+// jsonDecoder reads the fields of one node, keeping the first error so a
+// node can be built in a single expression.
+type jsonDecoder struct {
+	fields jsonFields
+	err    error
+}
+
+func (d *jsonDecoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *jsonDecoder) expr(name string) Expr {
+	expr, err := decodeExpr(d.fields[name])
+	d.fail(err)
+	return expr
+}
+
+// requiredExpr is like expr for a field that must hold an expression. It
+// fails if the field is absent or null.
+func (d *jsonDecoder) requiredExpr(name string) Expr {
+	expr := d.expr(name)
+	if expr == nil {
+		d.fail(fmt.Errorf("ast json: missing field %q", name))
+	}
+	return expr
+}
+
+func (d *jsonDecoder) exprs(name string) []Expr {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(d.fields[name], &raw); err != nil {
+		d.fail(fmt.Errorf("ast json: field %q: %w", name, err))
+	}
+	exprs := make([]Expr, 0, len(raw))
+	for _, r := range raw {
+		expr := d.exprFrom(r)
+		if expr == nil {
+			d.fail(fmt.Errorf("ast json: field %q: null expression", name))
+		}
+		exprs = append(exprs, expr)
+	}
+	return exprs
+}
+
+func (d *jsonDecoder) exprFrom(data []byte) Expr {
+	expr, err := decodeExpr(data)
+	d.fail(err)
+	return expr
+}
+
+func (d *jsonDecoder) stmt(name string) Stmt {
+	stmt, err := decodeStmt(d.fields[name])
+	d.fail(err)
+	return stmt
+}
+
+// requiredStmt is like stmt for a field that must hold a statement. It fails
+// if the field is absent or null.
+func (d *jsonDecoder) requiredStmt(name string) Stmt {
+	stmt := d.stmt(name)
+	if stmt == nil {
+		d.fail(fmt.Errorf("ast json: missing field %q", name))
+	}
+	return stmt
+}
+
+func (d *jsonDecoder) stmts(name string) []Stmt {
+	statements, err := decodeStmts(d.fields[name])
+	if err != nil {
+		d.fail(fmt.Errorf("ast json: field %q: %w", name, err))
+	}
+	if statements == nil {
+		statements = []Stmt{}
+	}
+	return statements
+}
+
+func (d *jsonDecoder) function() *FunctionStmt {
+	function := &FunctionStmt{Name: d.token("name"), Params: []scanner.Token{}, Body: d.stmts("body")}
+	var params []json.RawMessage
+	if err := json.Unmarshal(d.fields["params"], &params); err != nil {
+		d.fail(fmt.Errorf("ast json: field \"params\": %w", err))
+	}
+	for _, p := range params {
+		function.Params = append(function.Params, d.tokenFrom(p))
+	}
+	return function
+}
+
+func (d *jsonDecoder) forLoop(name string) *ForLoop {
+	if isNull(d.fields[name]) {
+		return nil
+	}
+	var loop jsonForLoop
+	if err := json.Unmarshal(d.fields[name], &loop); err != nil {
+		d.fail(fmt.Errorf("ast json: field %q: %w", name, err))
+		return nil
+	}
+	return &ForLoop{Initializer: loop.Initializer, Condition: loop.Condition, Increment: loop.Increment}
+}
+
+func (d *jsonDecoder) value(name string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal(d.fields[name], &value); err != nil {
+		d.fail(fmt.Errorf("ast json: field %q: %w", name, err))
+	}
+	return value
+}
+
+func (d *jsonDecoder) token(name string) scanner.Token {
+	return d.tokenFrom(d.fields[name])
+}
+
+func (d *jsonDecoder) tokenFrom(data []byte) scanner.Token {
+	var t jsonToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		d.fail(fmt.Errorf("ast json: token: %w", err))
+		return scanner.Token{}
+	}
+	tokenType, ok := tokenTypes[t.Type]
+	if !ok {
+		d.fail(fmt.Errorf("ast json: unknown token type %q", t.Type))
+	}
+	return scanner.Token{
+		Type:    tokenType,
+		Lexeme:  t.Lexeme,
+		Literal: t.Literal,
+		Line:    t.Line,
+		Column:  t.Column,
+		Start:   t.Start,
+		End:     t.End,
+	}
+}
+
+// tokenTypes maps token type names back to their values.
+var tokenTypes = func() map[string]scanner.TokenType {
+	types := make(map[string]scanner.TokenType, len(scanner.TokenTypeNames))
+	for tokenType, name := range scanner.TokenTypeNames {
+		types[name] = tokenType
+	}
+	return types
+}()
@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSON_RoundTrip(t *testing.T) {
+	sources := []string{
+		"print 1 + 2 * -3;",
+		"var a; var b = \"str\"; a = b = nil;",
+		"if (true and !false or a == 1) print 1; else { print 2; }",
+		"while (a < 10) a = a + 1;",
+		"for (var i = 0; i < 3; i = i + 1) print i;",
+		"fun add(a, b) { return a + b; } fun noop() { return; } print add(1, (2));",
+		"class A { init(x) { this.x = x; } get() { return this.x; } }",
+		"class B < A { get() { return super.get() + 1; } } B(1).get().y = 2;",
+	}
+
+	for _, source := range sources {
+		statements, err := ParseProgram(scanTokens(t, source))
+		if err != nil {
+			t.Fatalf("Parse error for %q: %v", source, err)
+		}
+
+		data, err := ProgramToJSON(statements)
+		if err != nil {
+			t.Fatalf("Encode error for %q: %v", source, err)
+		}
+		decoded, err := ProgramFromJSON(data)
+		if err != nil {
+			t.Fatalf("Decode error for %q: %v\n%s", source, err, data)
+		}
+		if !reflect.DeepEqual(statements, decoded) {
+			t.Errorf("Round trip of %q changed the AST:\n%s", source, data)
+		}
+	}
+}
+
+func TestJSON_ExprEncoding(t *testing.T) {
+	expr, err := Parse(scanTokens(t, "-x"))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	data, err := ExprToJSON(expr)
+	if err != nil {
+		t.Fatalf("Encode error: %v", err)
+	}
+
+	expected := `{"node":"Unary",` +
+		`"operator":{"type":"MINUS","lexeme":"-","line":1,"column":1,"start":0,"end":1},` +
+		`"right":{"node":"Variable","name":{"type":"IDENTIFIER","lexeme":"x","line":1,"column":2,"start":1,"end":2}}}`
+	if string(data) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, data)
+	}
+
+	decoded, err := ExprFromJSON(data)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !reflect.DeepEqual(expr, decoded) {
+		t.Errorf("Round trip changed the expression: %#v", decoded)
+	}
+}
+
+func TestJSON_DecodeErrors(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{`[{"node":"Nope"}]`, `unknown statement node "Nope"`},
+		{`[{"node":"Print","expression":{"node":"Print"}}]`, `unknown expression node "Print"`},
+		{`[{"foo":1}]`, "missing node type"},
+		{`[{"node":"Var","name":{"type":"BOGUS"}}]`, `unknown token type "BOGUS"`},
+		{`[{"node":"Class","name":{"type":"IDENTIFIER"},"superclass":{"node":"This","keyword":{"type":"THIS"}},"methods":[]}]`, "superclass must be a Variable node"},
+		{`{}`, "cannot unmarshal"},
+		{`[{"node":"Print","expression":{"node":"Binary","operator":{"type":"PLUS"},"right":{"node":"Literal","value":1}}}]`, `missing field "left"`},
+		{`[{"node":"Print","expression":{"node":"Unary","operator":{"type":"MINUS"},"right":null}}]`, `missing field "right"`},
+		{`[{"node":"Expression"}]`, `missing field "expression"`},
+		{`[{"node":"Expression","expression":{"node":"Call","paren":{"type":"RIGHT_PAREN"},"arguments":[]}}]`, `missing field "callee"`},
+		{`[{"node":"Expression","expression":{"node":"Get","name":{"type":"IDENTIFIER"}}}]`, `missing field "object"`},
+		{`[{"node":"Expression","expression":{"node":"Call","callee":{"node":"Variable","name":{"type":"IDENTIFIER"}},"paren":{"type":"RIGHT_PAREN"},"arguments":[null]}}]`, `field "arguments": null expression`},
+		{`[{"node":"If","thenBranch":{"node":"Block","statements":[]}}]`, `missing field "condition"`},
+		{`[{"node":"While","condition":{"node":"Literal","value":true}}]`, `missing field "body"`},
+		{`[null]`, "null statement"},
+	}
+
+	for _, tt := range tests {
+		_, err := ProgramFromJSON([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Decoding %s: expected error containing %q, got %v", tt.data, tt.expected, err)
+		}
+	}
+}
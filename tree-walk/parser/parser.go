@@ -3,36 +3,350 @@ package parser
 import (
 	"fmt"
 
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
 	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
 )
 
+// maxArgs is the maximum number of arguments or parameters a call or function
+// declaration may have.
+const maxArgs = 255
+
 type Parser struct {
 	tokens  []scanner.Token
 	current int
-	errors  []error
+	errors  ErrorList
+	ranges  map[Stmt]Range // nil unless ranges were requested
+}
+
+// Range is the span of tokens a statement was parsed from, from its first
+// token to its last, such as the closing ';' or '}'.
+type Range struct {
+	First scanner.Token
+	Last  scanner.Token
 }
 
+// parseError is panicked to unwind the parser back to a recovery point after
+// a syntax error has been recorded.
+type parseError struct{}
+
 func Parse(tokens []scanner.Token) (Expr, error) {
 	p := &Parser{tokens: tokens, current: 0}
 	return p.parse()
 }
 
-func (p *Parser) parse() (Expr, error) {
-	p.errors = []error{}
-	expr := p.expression()
-	if len(p.errors) > 0 {
-		return nil, p.errors[0] // Return the first error encountered
+// ParseProgram parses a whole program into a list of statements.
+func ParseProgram(tokens []scanner.Token) ([]Stmt, error) {
+	p := &Parser{tokens: tokens, current: 0}
+	return p.parseProgram()
+}
+
+// ParseProgramWithRanges is like ParseProgram but also returns the range of
+// tokens each statement was parsed from, including nested statements.
+// Statements synthesized while desugaring "for" loops have no range except
+// the outermost, which spans the whole loop.
+func ParseProgramWithRanges(tokens []scanner.Token) ([]Stmt, map[Stmt]Range, error) {
+	p := &Parser{tokens: tokens, current: 0, ranges: make(map[Stmt]Range)}
+	statements, err := p.parseProgram()
+	if err != nil {
+		return nil, nil, err
 	}
+	return statements, p.ranges, nil
+}
+
+func (p *Parser) parse() (expr Expr, err error) {
+	p.errors = nil
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(parseError); !ok {
+				panic(r)
+			}
+			expr, err = nil, p.errors
+		}
+	}()
+
+	expr = p.expression()
 	if !p.isAtEnd() {
-		err := p.error(p.peek(), "Unexpected token after expression.")
-		p.errors = append(p.errors, err)
-		return nil, err
+		p.report(p.peek(), diagnostics.TrailingTokens, "Unexpected token after expression.")
+	}
+	if len(p.errors) > 0 {
+		return nil, p.errors
 	}
 	return expr, nil
 }
 
+func (p *Parser) parseProgram() ([]Stmt, error) {
+	p.errors = nil
+	statements := []Stmt{}
+	for !p.isAtEnd() {
+		if stmt := p.declaration(); stmt != nil {
+			statements = append(statements, stmt)
+		}
+	}
+	if len(p.errors) > 0 {
+		return nil, p.errors
+	}
+	return statements, nil
+}
+
+// declaration parses one declaration. After a syntax error it discards tokens
+// up to the next statement boundary and returns nil so parsing can continue.
+func (p *Parser) declaration() (stmt Stmt) {
+	defer p.track(p.peek(), &stmt)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(parseError); !ok {
+				panic(r)
+			}
+			p.synchronize()
+			stmt = nil
+		}
+	}()
+
+	if p.match(scanner.CLASS) {
+		return p.classDeclaration()
+	}
+	if p.match(scanner.FUN) {
+		return p.function("function")
+	}
+	if p.match(scanner.VAR) {
+		return p.varDeclaration()
+	}
+
+	return p.statement()
+}
+
+func (p *Parser) classDeclaration() Stmt {
+	name := p.consume(scanner.IDENTIFIER, "Expect class name.")
+
+	var superclass *VariableExpr
+	if p.match(scanner.LESS) {
+		superclass = &VariableExpr{Name: p.consume(scanner.IDENTIFIER, "Expect superclass name.")}
+	}
+
+	p.consume(scanner.LEFT_BRACE, "Expect '{' before class body.")
+
+	methods := []*FunctionStmt{}
+	for !p.check(scanner.RIGHT_BRACE) && !p.isAtEnd() {
+		methods = append(methods, p.function("method"))
+	}
+
+	p.consume(scanner.RIGHT_BRACE, "Expect '}' after class body.")
+	return &ClassStmt{Name: name, Superclass: superclass, Methods: methods}
+}
+
+// function parses a function's name, parameters and body. kind describes the
+// declaration in error messages.
+func (p *Parser) function(kind string) *FunctionStmt {
+	name := p.consume(scanner.IDENTIFIER, "Expect "+kind+" name.")
+
+	p.consume(scanner.LEFT_PAREN, "Expect '(' after "+kind+" name.")
+	params := []scanner.Token{}
+	if !p.check(scanner.RIGHT_PAREN) {
+		for {
+			if len(params) >= maxArgs {
+				p.report(p.peek(), diagnostics.TooManyParameters, fmt.Sprintf("Can't have more than %d parameters.", maxArgs))
+			}
+			params = append(params, p.consume(scanner.IDENTIFIER, "Expect parameter name."))
+			if !p.match(scanner.COMMA) {
+				break
+			}
+		}
+	}
+	p.consume(scanner.RIGHT_PAREN, "Expect ')' after parameters.")
+
+	p.consume(scanner.LEFT_BRACE, "Expect '{' before "+kind+" body.")
+	body := p.block()
+	fn := &FunctionStmt{Name: name, Params: params, Body: body}
+	p.record(name, fn)
+	return fn
+}
+
+func (p *Parser) varDeclaration() Stmt {
+	name := p.consume(scanner.IDENTIFIER, "Expect variable name.")
+
+	var initializer Expr
+	if p.match(scanner.EQUAL) {
+		initializer = p.expression()
+	}
+
+	p.consume(scanner.SEMICOLON, "Expect ';' after variable declaration.")
+	return &VarStmt{Name: name, Initializer: initializer}
+}
+
+func (p *Parser) statement() (stmt Stmt) {
+	defer p.track(p.peek(), &stmt)
+
+	if p.match(scanner.FOR) {
+		return p.forStatement()
+	}
+	if p.match(scanner.IF) {
+		return p.ifStatement()
+	}
+	if p.match(scanner.PRINT) {
+		return p.printStatement()
+	}
+	if p.match(scanner.RETURN) {
+		return p.returnStatement()
+	}
+	if p.match(scanner.WHILE) {
+		return p.whileStatement()
+	}
+	if p.match(scanner.LEFT_BRACE) {
+		return &BlockStmt{Statements: p.block()}
+	}
+
+	return p.expressionStatement()
+}
+
+// forStatement parses a for loop and desugars it into an equivalent while
+// loop wrapped in blocks for the initializer and increment.
+func (p *Parser) forStatement() Stmt {
+	p.consume(scanner.LEFT_PAREN, "Expect '(' after 'for'.")
+
+	var initializer Stmt
+	if p.match(scanner.SEMICOLON) {
+		initializer = nil
+	} else if p.match(scanner.VAR) {
+		initializer = p.varDeclaration()
+	} else {
+		initializer = p.expressionStatement()
+	}
+
+	var condition Expr
+	if !p.check(scanner.SEMICOLON) {
+		condition = p.expression()
+	}
+	p.consume(scanner.SEMICOLON, "Expect ';' after loop condition.")
+
+	var increment Expr
+	if !p.check(scanner.RIGHT_PAREN) {
+		increment = p.expression()
+	}
+	p.consume(scanner.RIGHT_PAREN, "Expect ')' after for clauses.")
+
+	body := p.statement()
+
+	loop := &ForLoop{Initializer: initializer != nil, Condition: condition != nil, Increment: increment != nil}
+	if increment != nil {
+		body = &BlockStmt{Statements: []Stmt{body, &ExpressionStmt{Expression: increment}}}
+	}
+	if condition == nil {
+		condition = &LiteralExpr{Value: value.Bool(true)}
+	}
+	body = &WhileStmt{Condition: condition, Body: body, For: loop}
+	if initializer != nil {
+		body = &BlockStmt{Statements: []Stmt{initializer, body}}
+	}
+
+	return body
+}
+
+func (p *Parser) ifStatement() Stmt {
+	p.consume(scanner.LEFT_PAREN, "Expect '(' after 'if'.")
+	condition := p.expression()
+	p.consume(scanner.RIGHT_PAREN, "Expect ')' after if condition.")
+
+	thenBranch := p.statement()
+	var elseBranch Stmt
+	if p.match(scanner.ELSE) {
+		elseBranch = p.statement()
+	}
+
+	return &IfStmt{Condition: condition, ThenBranch: thenBranch, ElseBranch: elseBranch}
+}
+
+func (p *Parser) whileStatement() Stmt {
+	p.consume(scanner.LEFT_PAREN, "Expect '(' after 'while'.")
+	condition := p.expression()
+	p.consume(scanner.RIGHT_PAREN, "Expect ')' after condition.")
+	body := p.statement()
+
+	return &WhileStmt{Condition: condition, Body: body}
+}
+
+func (p *Parser) printStatement() Stmt {
+	value := p.expression()
+	p.consume(scanner.SEMICOLON, "Expect ';' after value.")
+	return &PrintStmt{Expression: value}
+}
+
+func (p *Parser) returnStatement() Stmt {
+	keyword := p.previous()
+	var value Expr
+	if !p.check(scanner.SEMICOLON) {
+		value = p.expression()
+	}
+
+	p.consume(scanner.SEMICOLON, "Expect ';' after return value.")
+	return &ReturnStmt{Keyword: keyword, Value: value}
+}
+
+func (p *Parser) expressionStatement() Stmt {
+	expr := p.expression()
+	p.consume(scanner.SEMICOLON, "Expect ';' after expression.")
+	return &ExpressionStmt{Expression: expr}
+}
+
+func (p *Parser) block() []Stmt {
+	statements := []Stmt{}
+
+	for !p.check(scanner.RIGHT_BRACE) && !p.isAtEnd() {
+		if stmt := p.declaration(); stmt != nil {
+			statements = append(statements, stmt)
+		}
+	}
+
+	p.consume(scanner.RIGHT_BRACE, "Expect '}' after block.")
+	return statements
+}
+
 func (p *Parser) expression() Expr {
-	return p.equality()
+	return p.assignment()
+}
+
+func (p *Parser) assignment() Expr {
+	expr := p.or()
+
+	if p.match(scanner.EQUAL) {
+		equals := p.previous()
+		value := p.assignment()
+
+		switch target := expr.(type) {
+		case *VariableExpr:
+			return &AssignExpr{Name: target.Name, Value: value}
+		case *GetExpr:
+			return &SetExpr{Object: target.Object, Name: target.Name, Value: value}
+		}
+
+		p.report(equals, diagnostics.InvalidAssignmentTarget, "Invalid assignment target.")
+	}
+
+	return expr
+}
+
+func (p *Parser) or() Expr {
+	expr := p.and()
+
+	for p.match(scanner.OR) {
+		operator := p.previous()
+		right := p.and()
+		expr = &LogicalExpr{Left: expr, Operator: operator, Right: right}
+	}
+
+	return expr
+}
+
+func (p *Parser) and() Expr {
+	expr := p.equality()
+
+	for p.match(scanner.AND) {
+		operator := p.previous()
+		right := p.equality()
+		expr = &LogicalExpr{Left: expr, Operator: operator, Right: right}
+	}
+
+	return expr
 }
 
 func (p *Parser) equality() Expr {
@@ -90,36 +404,82 @@ func (p *Parser) unary() Expr {
 		return &UnaryExpr{Operator: operator, Right: right}
 	}
 
-	return p.primary()
+	return p.call()
+}
+
+func (p *Parser) call() Expr {
+	expr := p.primary()
+
+	for {
+		if p.match(scanner.LEFT_PAREN) {
+			expr = p.finishCall(expr)
+		} else if p.match(scanner.DOT) {
+			name := p.consume(scanner.IDENTIFIER, "Expect property name after '.'.")
+			expr = &GetExpr{Object: expr, Name: name}
+		} else {
+			break
+		}
+	}
+
+	return expr
+}
+
+func (p *Parser) finishCall(callee Expr) Expr {
+	arguments := []Expr{}
+	if !p.check(scanner.RIGHT_PAREN) {
+		for {
+			if len(arguments) >= maxArgs {
+				p.report(p.peek(), diagnostics.TooManyArguments, fmt.Sprintf("Can't have more than %d arguments.", maxArgs))
+			}
+			arguments = append(arguments, p.expression())
+			if !p.match(scanner.COMMA) {
+				break
+			}
+		}
+	}
+
+	paren := p.consume(scanner.RIGHT_PAREN, "Expect ')' after arguments.")
+
+	return &CallExpr{Callee: callee, Paren: paren, Arguments: arguments}
 }
 
 func (p *Parser) primary() Expr {
 	if p.match(scanner.FALSE) {
-		return &LiteralExpr{Value: false}
+		return &LiteralExpr{Value: value.Bool(false)}
 	}
 	if p.match(scanner.TRUE) {
-		return &LiteralExpr{Value: true}
+		return &LiteralExpr{Value: value.Bool(true)}
 	}
 	if p.match(scanner.NIL) {
-		return &LiteralExpr{Value: nil}
+		return &LiteralExpr{Value: value.Nil}
 	}
 
 	if p.match(scanner.NUMBER, scanner.STRING) {
-		return &LiteralExpr{Value: p.previous().Literal}
+		return &LiteralExpr{Value: value.Of(p.previous().Literal)}
+	}
+
+	if p.match(scanner.SUPER) {
+		keyword := p.previous()
+		p.consume(scanner.DOT, "Expect '.' after 'super'.")
+		method := p.consume(scanner.IDENTIFIER, "Expect superclass method name.")
+		return &SuperExpr{Keyword: keyword, Method: method}
+	}
+
+	if p.match(scanner.THIS) {
+		return &ThisExpr{Keyword: p.previous()}
+	}
+
+	if p.match(scanner.IDENTIFIER) {
+		return &VariableExpr{Name: p.previous()}
 	}
 
 	if p.match(scanner.LEFT_PAREN) {
 		expr := p.expression()
-		if err := p.consume(scanner.RIGHT_PAREN, "Expect ')' after expression."); err != nil {
-			p.errors = append(p.errors, err)
-			return nil
-		}
+		p.consume(scanner.RIGHT_PAREN, "Expect ')' after expression.")
 		return &GroupingExpr{Expression: expr}
 	}
 
-	err := p.error(p.peek(), "Expect expression.")
-	p.errors = append(p.errors, err)
-	return nil
+	panic(p.error(p.peek(), diagnostics.ExpectedExpression, "Expect expression."))
 }
 
 func (p *Parser) match(types ...scanner.TokenType) bool {
@@ -132,13 +492,14 @@ func (p *Parser) match(types ...scanner.TokenType) bool {
 	return false
 }
 
-func (p *Parser) consume(tokenType scanner.TokenType, message string) error {
+// consume advances past the expected token, or reports a syntax error and
+// unwinds to the nearest recovery point.
+func (p *Parser) consume(tokenType scanner.TokenType, message string) scanner.Token {
 	if p.check(tokenType) {
-		p.advance()
-		return nil
+		return p.advance()
 	}
 
-	return p.error(p.peek(), message)
+	panic(p.error(p.peek(), diagnostics.ExpectedToken, message))
 }
 
 func (p *Parser) check(tokenType scanner.TokenType) bool {
@@ -167,9 +528,48 @@ func (p *Parser) previous() scanner.Token {
 	return p.tokens[p.current-1]
 }
 
-func (p *Parser) error(token scanner.Token, message string) error {
-	if token.Type == scanner.EOF {
-		return fmt.Errorf("[line %d] Error at end: %s", token.Line, message)
+// track is deferred by the statement parsing methods to record the range of
+// the statement they return. stmt is nil when parsing failed.
+func (p *Parser) track(first scanner.Token, stmt *Stmt) {
+	p.record(first, *stmt)
+}
+
+// record notes that stmt starts at first and ends at the previous token, if
+// ranges are being collected.
+func (p *Parser) record(first scanner.Token, stmt Stmt) {
+	if p.ranges != nil && stmt != nil {
+		p.ranges[stmt] = Range{First: first, Last: p.previous()}
+	}
+}
+
+// report records a syntax error without interrupting the current parse.
+func (p *Parser) report(token scanner.Token, code diagnostics.Code, message string) {
+	p.errors = append(p.errors, &Error{Code: code, Token: token, Message: message})
+}
+
+// error records a syntax error and returns the value to panic with in order
+// to unwind to the nearest recovery point.
+func (p *Parser) error(token scanner.Token, code diagnostics.Code, message string) parseError {
+	p.report(token, code, message)
+	return parseError{}
+}
+
+// synchronize discards tokens until it reaches what is likely the start of
+// the next statement.
+func (p *Parser) synchronize() {
+	p.advance()
+
+	for !p.isAtEnd() {
+		if p.previous().Type == scanner.SEMICOLON {
+			return
+		}
+
+		switch p.peek().Type {
+		case scanner.CLASS, scanner.FUN, scanner.VAR, scanner.FOR,
+			scanner.IF, scanner.WHILE, scanner.PRINT, scanner.RETURN:
+			return
+		}
+
+		p.advance()
 	}
-	return fmt.Errorf("[line %d] Error at '%s': %s", token.Line, token.Lexeme, message)
 }
@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
 	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
 )
 
@@ -18,7 +21,7 @@ func TestParser_BasicExpressions(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		tokens := scanner.ScanTokens(tt.source)
+		tokens := scanTokens(t, tt.source)
 		expr, err := Parse(tokens)
 		if err != nil {
 			t.Errorf("Unexpected parse error for source: %s\nError: %v", tt.source, err)
@@ -43,28 +46,28 @@ func TestParser_ErrorCases(t *testing.T) {
 	}{
 		{
 			source:        "(1 + 2 * 3",
-			expectedError: "[line 1] Error at end: Expect ')' after expression.",
+			expectedError: "[line 1, column 11] Error at end: Expect ')' after expression.",
 		},
 		{
 			source:        "1 + * 3",
-			expectedError: "[line 1] Error at '*': Expect expression.",
+			expectedError: "[line 1, column 5] Error at '*': Expect expression.",
 		},
 		{
 			source:        "1 +",
-			expectedError: "[line 1] Error at end: Expect expression.",
+			expectedError: "[line 1, column 4] Error at end: Expect expression.",
 		},
 		{
 			source:        "!",
-			expectedError: "[line 1] Error at end: Expect expression.",
+			expectedError: "[line 1, column 2] Error at end: Expect expression.",
 		},
 		{
 			source:        "1 + 2)) * 3",
-			expectedError: "[line 1] Error at ')': Unexpected token after expression.",
+			expectedError: "[line 1, column 6] Error at ')': Unexpected token after expression.",
 		},
 	}
 
 	for _, tt := range tests {
-		tokens := scanner.ScanTokens(tt.source)
+		tokens := scanTokens(t, tt.source)
 		_, err := Parse(tokens)
 		if err == nil {
 			t.Errorf("Expected parse error for source: %s\nBut got none", tt.source)
@@ -76,3 +79,274 @@ func TestParser_ErrorCases(t *testing.T) {
 		}
 	}
 }
+
+func TestParser_Statements(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected []string
+	}{
+		{"print 1 + 2;", []string{"(print (+ 1 2))"}},
+		{"1 + 2; print \"hi\";", []string{"(; (+ 1 2))", "(print hi)"}},
+		{"", []string{}},
+		{"var a = 1; var b;", []string{"(var a 1)", "(var b)"}},
+		{"a = b = 2;", []string{"(; (= a (= b 2)))"}},
+		{"{ var a; print a; }", []string{"(block (var a) (print a))"}},
+		{"if (a) print 1; else print 2;", []string{"(if a (print 1) (print 2))"}},
+		{"while (a or b and c) a = 1;", []string{"(while (or a (and b c)) (; (= a 1)))"}},
+		{
+			"for (var i = 0; i < 2; i = i + 1) print i;",
+			[]string{"(block (var i 0) (while (< i 2) (block (print i) (; (= i (+ i 1))))))"},
+		},
+		{"for (;;) print 1;", []string{"(while true (print 1))"}},
+		{"fun add(a, b) { return a + b; }", []string{"(fun add (params a b) (return (+ a b)))"}},
+		{"fun f() { return; }", []string{"(fun f (params) (return))"}},
+		{"f(1, 2)(3);", []string{"(; (call (call f 1 2) 3))"}},
+		{
+			"class A { init(x) { this.x = x; } get() { return this.x; } }",
+			[]string{"(class A (fun init (params x) (; (= this x x))) (fun get (params) (return (. this x))))"},
+		},
+		{"a.b.c = d.e();", []string{"(; (= (. a b) c (call (. d e))))"}},
+		{
+			"class B < A { m() { return super.m(); } }",
+			[]string{"(class B < A (fun m (params) (return (call (super m)))))"},
+		},
+	}
+
+	for _, tt := range tests {
+		tokens := scanTokens(t, tt.source)
+		statements, err := ParseProgram(tokens)
+		if err != nil {
+			t.Errorf("Unexpected parse error for source: %s\nError: %v", tt.source, err)
+			continue
+		}
+		if len(statements) != len(tt.expected) {
+			t.Errorf("Source: %s\nExpected %d statements, got %d", tt.source, len(tt.expected), len(statements))
+			continue
+		}
+		printer := &AstPrinter{}
+		for i, stmt := range statements {
+			result, err := printer.PrintStmt(stmt)
+			if err != nil {
+				t.Errorf("Error printing AST for source: %s\nError: %v", tt.source, err)
+				continue
+			}
+			if result != tt.expected[i] {
+				t.Errorf("Source: %s\nExpected: %s\nGot: %s", tt.source, tt.expected[i], result)
+			}
+		}
+	}
+}
+
+func TestParser_StatementErrors(t *testing.T) {
+	tests := []struct {
+		source        string
+		expectedError string
+	}{
+		{
+			source:        "print 1",
+			expectedError: "[line 1, column 8] Error at end: Expect ';' after value.",
+		},
+		{
+			source:        "1 + 2\nprint 3;",
+			expectedError: "[line 2, column 1] Error at 'print': Expect ';' after expression.",
+		},
+		{
+			source:        "var 1 = 2;",
+			expectedError: "[line 1, column 5] Error at '1': Expect variable name.",
+		},
+		{
+			source:        "1 + a = 3;",
+			expectedError: "[line 1, column 7] Error at '=': Invalid assignment target.",
+		},
+		{
+			source:        "{ print 1;",
+			expectedError: "[line 1, column 11] Error at end: Expect '}' after block.",
+		},
+		{
+			source:        "if true) print 1;",
+			expectedError: "[line 1, column 4] Error at 'true': Expect '(' after 'if'.",
+		},
+		{
+			source:        "for (var i = 0; i < 2) print i;",
+			expectedError: "[line 1, column 22] Error at ')': Expect ';' after loop condition.",
+		},
+		{
+			source:        "fun (a) {}",
+			expectedError: "[line 1, column 5] Error at '(': Expect function name.",
+		},
+		{
+			source:        "f(1, 2;",
+			expectedError: "[line 1, column 7] Error at ';': Expect ')' after arguments.",
+		},
+		{
+			source:        "f(" + strings.Repeat("1, ", 255) + "1);",
+			expectedError: "[line 1, column 768] Error at '1': Can't have more than 255 arguments.",
+		},
+		{
+			source:        "fun f(" + strings.Repeat("a, ", 255) + "a) {}",
+			expectedError: "[line 1, column 772] Error at 'a': Can't have more than 255 parameters.",
+		},
+		{
+			source:        "class { }",
+			expectedError: "[line 1, column 7] Error at '{': Expect class name.",
+		},
+		{
+			source:        "a.1 = 2;",
+			expectedError: "[line 1, column 3] Error at '1': Expect property name after '.'.",
+		},
+		{
+			source:        "class B < {}",
+			expectedError: "[line 1, column 11] Error at '{': Expect superclass name.",
+		},
+		{
+			source:        "super;",
+			expectedError: "[line 1, column 6] Error at ';': Expect '.' after 'super'.",
+		},
+	}
+
+	for _, tt := range tests {
+		tokens := scanTokens(t, tt.source)
+		_, err := ParseProgram(tokens)
+		if err == nil {
+			t.Errorf("Expected parse error for source: %s\nBut got none", tt.source)
+			continue
+		}
+
+		if err.Error() != tt.expectedError {
+			t.Errorf("Source: %s\nExpected Error: %s\nGot Error: %s", tt.source, tt.expectedError, err.Error())
+		}
+	}
+}
+
+func TestParser_CollectsAllErrors(t *testing.T) {
+	source := `var 1 = 2;
+print (1 + ;
+var ok = 3;
+fun f( { }
+print ok`
+
+	_, err := ParseProgram(scanTokens(t, source))
+	if err == nil {
+		t.Fatalf("Expected parse errors but got none")
+	}
+
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("Expected an ErrorList, got %T", err)
+	}
+
+	expected := []string{
+		"[line 1, column 5] Error at '1': Expect variable name.",
+		"[line 2, column 12] Error at ';': Expect expression.",
+		"[line 4, column 8] Error at '{': Expect parameter name.",
+		"[line 5, column 9] Error at end: Expect ';' after value.",
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d:\n%v", len(expected), len(list), err)
+	}
+	for i, e := range list {
+		if e.Error() != expected[i] {
+			t.Errorf("Error %d\nExpected: %s\nGot: %s", i, expected[i], e.Error())
+		}
+	}
+	if err.Error() != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected combined message:\n%s", err.Error())
+	}
+	if list[0].Token.Lexeme != "1" || list[0].Message != "Expect variable name." {
+		t.Errorf("Unexpected structured error: %+v", list[0])
+	}
+	if list[0].Code != diagnostics.ExpectedToken || list[1].Code != diagnostics.ExpectedExpression {
+		t.Errorf("Unexpected error codes: %s, %s", list[0].Code, list[1].Code)
+	}
+}
+
+func TestParser_ReportsWithoutUnwinding(t *testing.T) {
+	source := "1 = 2;\na + b = 3;"
+
+	_, err := ParseProgram(scanTokens(t, source))
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("Expected an ErrorList, got %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("Expected 2 errors, got %d:\n%v", len(list), err)
+	}
+	if list[1].Token.Line != 2 {
+		t.Errorf("Expected second error on line 2, got %d", list[1].Token.Line)
+	}
+}
+
+func TestParser_Incomplete(t *testing.T) {
+	tests := []struct {
+		source     string
+		incomplete bool
+	}{
+		{"{ print 1;", true},
+		{"fun f() {", true},
+		{"print (1 +", true},
+		{"var a = 1", true},
+		{"class A { m() {", true},
+		{"print 1;)", false},
+		{"{ var = 1;", false},
+		{"1 = 2;", false},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseProgram(scanTokens(t, tt.source))
+		var list ErrorList
+		if !errors.As(err, &list) {
+			t.Fatalf("Expected an ErrorList for %q, got %v", tt.source, err)
+		}
+		if got := list.Incomplete(); got != tt.incomplete {
+			t.Errorf("Incomplete() for %q: expected %v, got %v", tt.source, tt.incomplete, got)
+		}
+	}
+}
+
+func TestParser_Ranges(t *testing.T) {
+	source := "var a = 1;\nfor (;;) {\n  print a;\n}\nclass C {\n  m() { return; }\n}\nfun f() {}"
+
+	statements, ranges, err := ParseProgramWithRanges(scanTokens(t, source))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	loop := statements[1].(*WhileStmt)
+	class := statements[2].(*ClassStmt)
+	method := class.Methods[0]
+
+	tests := []struct {
+		stmt        Stmt
+		first, last string
+		firstLine   int
+		lastLine    int
+	}{
+		{statements[0], "var", ";", 1, 1},
+		{loop, "for", "}", 2, 4},
+		{loop.Body, "{", "}", 2, 4},
+		{loop.Body.(*BlockStmt).Statements[0], "print", ";", 3, 3},
+		{class, "class", "}", 5, 7},
+		{method, "m", "}", 6, 6},
+		{method.Body[0], "return", ";", 6, 6},
+		{statements[3], "fun", "}", 8, 8},
+	}
+	for i, tt := range tests {
+		r, ok := ranges[tt.stmt]
+		if !ok {
+			t.Errorf("Statement %d: no range recorded", i)
+			continue
+		}
+		if r.First.Lexeme != tt.first || r.Last.Lexeme != tt.last || r.First.Line != tt.firstLine || r.Last.Line != tt.lastLine {
+			t.Errorf("Statement %d: expected %q (line %d) to %q (line %d), got %q (line %d) to %q (line %d)",
+				i, tt.first, tt.firstLine, tt.last, tt.lastLine, r.First.Lexeme, r.First.Line, r.Last.Lexeme, r.Last.Line)
+		}
+	}
+}
+
+func scanTokens(t *testing.T, source string) []scanner.Token {
+	t.Helper()
+	tokens, errs := scanner.ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Scan errors for source: %s\nErrors: %v", source, errs)
+	}
+	return tokens
+}
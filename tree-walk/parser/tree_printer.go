@@ -0,0 +1,185 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TreePrinter renders the AST as an indented tree with one node per line and
+// children indented below their parent:
+//
+//	Print
+//	  Binary +
+//	    Literal 1
+//	    Literal 2
+type TreePrinter struct{}
+
+// Print returns the tree for an expression.
+func (t *TreePrinter) Print(expr Expr) (string, error) {
+	result, err := expr.Accept(t)
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
+
+// PrintStmt returns the tree for a statement.
+func (t *TreePrinter) PrintStmt(stmt Stmt) (string, error) {
+	result, err := stmt.Accept(t)
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
+
+// Visitor methods for TreePrinter.
+
+func (t *TreePrinter) VisitBinaryExpr(expr *BinaryExpr) (interface{}, error) {
+	return t.node("Binary "+expr.Operator.Lexeme, expr.Left, expr.Right)
+}
+
+func (t *TreePrinter) VisitGroupingExpr(expr *GroupingExpr) (interface{}, error) {
+	return t.node("Grouping", expr.Expression)
+}
+
+func (t *TreePrinter) VisitLiteralExpr(expr *LiteralExpr) (interface{}, error) {
+	switch value := expr.Value.Interface().(type) {
+	case nil:
+		return "Literal nil", nil
+	case string:
+		return fmt.Sprintf("Literal %q", value), nil
+	default:
+		return fmt.Sprintf("Literal %v", value), nil
+	}
+}
+
+func (t *TreePrinter) VisitUnaryExpr(expr *UnaryExpr) (interface{}, error) {
+	return t.node("Unary "+expr.Operator.Lexeme, expr.Right)
+}
+
+func (t *TreePrinter) VisitVariableExpr(expr *VariableExpr) (interface{}, error) {
+	return "Variable " + expr.Name.Lexeme, nil
+}
+
+func (t *TreePrinter) VisitAssignExpr(expr *AssignExpr) (interface{}, error) {
+	return t.node("Assign "+expr.Name.Lexeme, expr.Value)
+}
+
+func (t *TreePrinter) VisitLogicalExpr(expr *LogicalExpr) (interface{}, error) {
+	return t.node("Logical "+expr.Operator.Lexeme, expr.Left, expr.Right)
+}
+
+func (t *TreePrinter) VisitCallExpr(expr *CallExpr) (interface{}, error) {
+	children := []interface{}{expr.Callee}
+	for _, argument := range expr.Arguments {
+		children = append(children, argument)
+	}
+	return t.node("Call", children...)
+}
+
+func (t *TreePrinter) VisitGetExpr(expr *GetExpr) (interface{}, error) {
+	return t.node("Get "+expr.Name.Lexeme, expr.Object)
+}
+
+func (t *TreePrinter) VisitSetExpr(expr *SetExpr) (interface{}, error) {
+	return t.node("Set "+expr.Name.Lexeme, expr.Object, expr.Value)
+}
+
+func (t *TreePrinter) VisitThisExpr(expr *ThisExpr) (interface{}, error) {
+	return "This", nil
+}
+
+func (t *TreePrinter) VisitSuperExpr(expr *SuperExpr) (interface{}, error) {
+	return "Super " + expr.Method.Lexeme, nil
+}
+
+func (t *TreePrinter) VisitExpressionStmt(stmt *ExpressionStmt) (interface{}, error) {
+	return t.node("Expression", stmt.Expression)
+}
+
+func (t *TreePrinter) VisitPrintStmt(stmt *PrintStmt) (interface{}, error) {
+	return t.node("Print", stmt.Expression)
+}
+
+func (t *TreePrinter) VisitVarStmt(stmt *VarStmt) (interface{}, error) {
+	if stmt.Initializer == nil {
+		return "Var " + stmt.Name.Lexeme, nil
+	}
+	return t.node("Var "+stmt.Name.Lexeme, stmt.Initializer)
+}
+
+func (t *TreePrinter) VisitBlockStmt(stmt *BlockStmt) (interface{}, error) {
+	return t.node("Block", stmts(stmt.Statements)...)
+}
+
+func (t *TreePrinter) VisitIfStmt(stmt *IfStmt) (interface{}, error) {
+	if stmt.ElseBranch == nil {
+		return t.node("If", stmt.Condition, stmt.ThenBranch)
+	}
+	return t.node("If", stmt.Condition, stmt.ThenBranch, stmt.ElseBranch)
+}
+
+func (t *TreePrinter) VisitWhileStmt(stmt *WhileStmt) (interface{}, error) {
+	return t.node("While", stmt.Condition, stmt.Body)
+}
+
+func (t *TreePrinter) VisitFunctionStmt(stmt *FunctionStmt) (interface{}, error) {
+	params := make([]string, 0, len(stmt.Params))
+	for _, param := range stmt.Params {
+		params = append(params, param.Lexeme)
+	}
+	label := fmt.Sprintf("Fun %s(%s)", stmt.Name.Lexeme, strings.Join(params, ", "))
+	return t.node(label, stmts(stmt.Body)...)
+}
+
+func (t *TreePrinter) VisitReturnStmt(stmt *ReturnStmt) (interface{}, error) {
+	if stmt.Value == nil {
+		return "Return", nil
+	}
+	return t.node("Return", stmt.Value)
+}
+
+func (t *TreePrinter) VisitClassStmt(stmt *ClassStmt) (interface{}, error) {
+	label := "Class " + stmt.Name.Lexeme
+	if stmt.Superclass != nil {
+		label += " < " + stmt.Superclass.Name.Lexeme
+	}
+	children := make([]interface{}, 0, len(stmt.Methods))
+	for _, method := range stmt.Methods {
+		children = append(children, method)
+	}
+	return t.node(label, children...)
+}
+
+// node renders label followed by each child, an Expr or Stmt, indented one
+// level below it.
+func (t *TreePrinter) node(label string, children ...interface{}) (string, error) {
+	var b strings.Builder
+	b.WriteString(label)
+	for _, child := range children {
+		var result interface{}
+		var err error
+		switch c := child.(type) {
+		case Expr:
+			result, err = c.Accept(t)
+		case Stmt:
+			result, err = c.Accept(t)
+		}
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(result.(string), "\n") {
+			b.WriteString("\n  " + line)
+		}
+	}
+	return b.String(), nil
+}
+
+// stmts converts statements to node children.
+func stmts(statements []Stmt) []interface{} {
+	children := make([]interface{}, len(statements))
+	for i, s := range statements {
+		children[i] = s
+	}
+	return children
+}
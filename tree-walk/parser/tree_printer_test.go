@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTreePrinter(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"print -(1 + 2) * \"x\";", `
+Print
+  Binary *
+    Unary -
+      Grouping
+        Binary +
+          Literal 1
+          Literal 2
+    Literal "x"`},
+		{"var a; a = nil or true;", `
+Var a
+Expression
+  Assign a
+    Logical or
+      Literal nil
+      Literal true`},
+		{"if (a) { f(1, b); } else return;", `
+If
+  Variable a
+  Block
+    Expression
+      Call
+        Variable f
+        Literal 1
+        Variable b
+  Return`},
+		{"class B < A { init(x, y) { this.x = super.m; } }", `
+Class B < A
+  Fun init(x, y)
+    Expression
+      Set x
+        This
+        Super m`},
+		{"while (o.done) {}", `
+While
+  Get done
+    Variable o
+  Block`},
+	}
+
+	printer := &TreePrinter{}
+	for _, tt := range tests {
+		statements, err := ParseProgram(scanTokens(t, tt.source))
+		if err != nil {
+			t.Fatalf("Parse error for %q: %v", tt.source, err)
+		}
+		var lines []string
+		for _, stmt := range statements {
+			s, err := printer.PrintStmt(stmt)
+			if err != nil {
+				t.Fatalf("Print error for %q: %v", tt.source, err)
+			}
+			lines = append(lines, s)
+		}
+		if got := strings.Join(lines, "\n"); got != strings.TrimPrefix(tt.expected, "\n") {
+			t.Errorf("Source %q:\nexpected:\n%s\ngot:\n%s", tt.source, strings.TrimPrefix(tt.expected, "\n"), got)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/interpreter"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/lineedit"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/resolver"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = "... "
+	historyFileName    = ".lox_history"
+)
+
+// replCommands describes the meta-commands, which start with ':' and are
+// handled by the REPL instead of being run as Lox.
+var replCommands = []struct {
+	name, args, help string
+}{
+	{"tokens", "<source>", "show the tokens scanned from source"},
+	{"ast", "<source>", "show the syntax tree parsed from source"},
+	{"env", "", "list the global variables"},
+	{"load", "<file>", "run a Lox file in this session"},
+	{"reset", "", "discard every definition and start over"},
+	{"help", "", "show this list"},
+	{"quit", "", "leave the REPL"},
+}
+
+// repl is an interactive session. Every input runs against the same
+// interpreter, so variables, functions and classes declared on one line are
+// visible to the following ones.
+type repl struct {
+	interp  *interpreter.Interpreter
+	out     io.Writer
+	report  func(filename, source string, err error)
+	pending []string // lines of an input that is not complete yet
+	done    bool     // set by :quit
+}
+
+func newREPL(out io.Writer) *repl {
+	r := &repl{out: out, report: reportErrors}
+	r.reset()
+	return r
+}
+
+func (r *repl) reset() {
+	r.interp = interpreter.NewInterpreter()
+	r.interp.SetOutput(r.out)
+	r.pending = nil
+}
+
+func runPrompt() {
+	r := newREPL(os.Stdout)
+	editor := lineedit.New(os.Stdin, os.Stdout)
+	editor.Complete = r.complete
+	if home, err := os.UserHomeDir(); err == nil {
+		if err := editor.LoadHistory(filepath.Join(home, historyFileName)); err != nil {
+			fmt.Fprintln(os.Stderr, "loading history:", err)
+		}
+	}
+
+	for !r.done {
+		p := prompt
+		if len(r.pending) > 0 {
+			p = continuationPrompt
+		}
+		line, err := editor.ReadLine(p)
+		if errors.Is(err, lineedit.ErrInterrupted) {
+			r.pending = nil
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "reading standard input:", err)
+			break
+		}
+		if err := editor.AddHistory(line); err != nil {
+			fmt.Fprintln(os.Stderr, "saving history:", err)
+		}
+		r.feed(line)
+	}
+}
+
+// feed adds a line of input to the session. Once the accumulated input forms
+// a complete program it is run; if it is a valid prefix of one, such as an
+// unclosed block or a statement missing its ';', feed keeps it and returns
+// true to ask for more. An empty line while input is pending gives up and
+// reports the errors as they stand.
+func (r *repl) feed(line string) (more bool) {
+	if len(r.pending) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+		r.command(strings.TrimSpace(line))
+		return false
+	}
+
+	const filename = "<stdin>"
+	force := len(r.pending) > 0 && strings.TrimSpace(line) == ""
+	r.pending = append(r.pending, line)
+	source := strings.Join(r.pending, "\n")
+
+	tokens, scanErrors := scanner.ScanTokens(source)
+	if len(scanErrors) > 0 {
+		if !force && unterminated(scanErrors) {
+			return true
+		}
+		r.pending = nil
+		r.report(filename, source, errors.Join(scanErrors...))
+		return false
+	}
+
+	statements, echo, err := parseInput(tokens)
+	if err != nil {
+		var list parser.ErrorList
+		if !force && errors.As(err, &list) && list.Incomplete() {
+			return true
+		}
+		r.pending = nil
+		r.report(filename, source, err)
+		return false
+	}
+	r.pending = nil
+
+	r.execute(filename, source, statements, echo)
+	return false
+}
+
+// execute resolves and runs statements in the session and returns the exit
+// code a script would have. With echo set, statements holds a single
+// expression statement whose value is printed.
+func (r *repl) execute(filename, source string, statements []parser.Stmt, echo bool) int {
+	if err := resolver.NewResolver(r.interp).Resolve(statements); err != nil {
+		r.report(filename, source, err)
+		return exitDataErr
+	}
+	statements, err := optimize(statements)
+	if err != nil {
+		r.report(filename, source, err)
+		return exitDataErr
+	}
+
+	if echo {
+		value, err := r.interp.Interpret(statements[0].(*parser.ExpressionStmt).Expression)
+		if err != nil {
+			r.report(filename, source, err)
+			return exitSoftware
+		}
+		fmt.Fprintln(r.out, interpreter.Stringify(value))
+		return 0
+	}
+
+	if err := r.interp.Execute(statements); err != nil {
+		r.report(filename, source, err)
+		return exitSoftware
+	}
+	return 0
+}
+
+// command runs a meta-command line such as ":load file.lox".
+func (r *repl) command(line string) {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "tokens":
+		r.showTokens(arg)
+	case "ast":
+		r.showAST(arg)
+	case "env":
+		r.showEnv()
+	case "load":
+		r.load(arg)
+	case "reset":
+		r.reset()
+	case "help":
+		for _, c := range replCommands {
+			fmt.Fprintf(r.out, "  :%-16s %s\n", strings.TrimSpace(c.name+" "+c.args), c.help)
+		}
+	case "quit", "q", "exit":
+		r.done = true
+	default:
+		fmt.Fprintf(r.out, "Unknown command ':%s'. Type :help for a list of commands.\n", name)
+	}
+}
+
+func (r *repl) showTokens(source string) {
+	tokens, scanErrors := scanner.ScanTokens(source)
+	for _, token := range tokens {
+		fmt.Fprintln(r.out, token)
+	}
+	if len(scanErrors) > 0 {
+		r.report("<stdin>", source, errors.Join(scanErrors...))
+	}
+}
+
+func (r *repl) showAST(source string) {
+	tokens, scanErrors := scanner.ScanTokens(source)
+	if len(scanErrors) > 0 {
+		r.report("<stdin>", source, errors.Join(scanErrors...))
+		return
+	}
+
+	printer := &parser.AstPrinter{}
+	if expr, err := parser.Parse(tokens); err == nil {
+		s, _ := printer.Print(expr)
+		fmt.Fprintln(r.out, s)
+		return
+	}
+	statements, err := parser.ParseProgram(tokens)
+	if err != nil {
+		r.report("<stdin>", source, err)
+		return
+	}
+	for _, stmt := range statements {
+		s, _ := printer.PrintStmt(stmt)
+		fmt.Fprintln(r.out, s)
+	}
+}
+
+func (r *repl) showEnv() {
+	globals := r.interp.Globals()
+	names := make([]string, 0, len(globals))
+	for name := range globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.out, "%s = %s\n", name, interpreter.Stringify(globals[name]))
+	}
+}
+
+func (r *repl) load(filename string) {
+	if filename == "" {
+		fmt.Fprintln(r.out, "Usage: :load <file>")
+		return
+	}
+	bytes, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+		return
+	}
+	source := string(bytes)
+
+	tokens, scanErrors := scanner.ScanTokens(source)
+	statements, err := parser.ParseProgram(tokens)
+	if len(scanErrors) > 0 || err != nil {
+		r.report(filename, source, errors.Join(append(scanErrors, err)...))
+		return
+	}
+	r.execute(filename, source, statements, false)
+}
+
+// complete returns the keywords, globals and meta-commands that start with
+// word, for tab completion.
+func (r *repl) complete(word string) []string {
+	var candidates []string
+	add := func(name string) {
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, name)
+		}
+	}
+	for _, keyword := range scanner.Keywords() {
+		add(keyword)
+	}
+	for name := range r.interp.Globals() {
+		add(name)
+	}
+	for _, c := range replCommands {
+		add(c.name)
+	}
+	sort.Strings(candidates)
+	return dedupe(candidates)
+}
+
+// dedupe removes adjacent duplicates from a sorted list.
+func dedupe(words []string) []string {
+	out := words[:0]
+	for i, w := range words {
+		if i == 0 || w != words[i-1] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// parseInput parses a REPL input. A bare expression, with or without its
+// trailing ';', is returned as a single expression statement with echo set
+// so its value is printed.
+func parseInput(tokens []scanner.Token) (statements []parser.Stmt, echo bool, err error) {
+	if expr, err := parser.Parse(tokens); err == nil {
+		return []parser.Stmt{&parser.ExpressionStmt{Expression: expr}}, true, nil
+	}
+
+	statements, err = parser.ParseProgram(tokens)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(statements) == 1 {
+		_, echo = statements[0].(*parser.ExpressionStmt)
+	}
+	return statements, echo, nil
+}
+
+// unterminated reports whether every scan error is a string or comment that
+// runs to the end of the input.
+func unterminated(errs []error) bool {
+	for _, err := range errs {
+		var scanErr *scanner.Error
+		if !errors.As(err, &scanErr) {
+			return false
+		}
+		if scanErr.Code != diagnostics.UnterminatedString && scanErr.Code != diagnostics.UnterminatedComment {
+			return false
+		}
+	}
+	return true
+}
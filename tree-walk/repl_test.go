@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// feedAll runs lines through a fresh REPL session and returns what it
+// printed, the errors it reported and whether it was left waiting for more
+// input.
+func feedAll(lines ...string) (output string, errs []string, more bool) {
+	var out strings.Builder
+	r := newREPL(&out)
+	r.report = func(filename, source string, err error) {
+		errs = append(errs, err.Error())
+	}
+	for _, line := range lines {
+		more = r.feed(line)
+	}
+	return out.String(), errs, more
+}
+
+func TestREPL_Session(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		expected string
+		more     bool
+	}{
+		{"expression echo", []string{"1 + 2"}, "3\n", false},
+		{"expression statement echo", []string{"\"a\" + \"b\";"}, "ab\n", false},
+		{"state persists", []string{"var a = 1;", "a = a + 1;", "print a;"}, "2\n2\n", false},
+		{"functions persist", []string{"fun sq(x) { return x * x; }", "sq(4)"}, "16\n", false},
+		{"closures persist", []string{
+			"fun counter() { var n = 0; fun inc() { n = n + 1; return n; } return inc; }",
+			"var c = counter();",
+			"c();",
+			"c()",
+		}, "1\n2\n", false},
+		{"multi-line block", []string{"{", "  var x = 3;", "  print x;", "}"}, "3\n", false},
+		{"multi-line class", []string{
+			"class A {",
+			"  greet() { return \"hi\"; }",
+			"}",
+			"A().greet()",
+		}, "hi\n", false},
+		{"missing semicolon", []string{"print 1", ";"}, "1\n", false},
+		{"open paren", []string{"print (1 +", "2);"}, "3\n", false},
+		{"multi-line string", []string{"print \"a", "b\";"}, "a\nb\n", false},
+		{"waiting", []string{"fun f() {"}, "", true},
+		{"statements not echoed", []string{"var a = 1; a;"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errs, more := feedAll(tt.lines...)
+			if len(errs) > 0 {
+				t.Fatalf("Unexpected errors: %v", errs)
+			}
+			if output != tt.expected {
+				t.Errorf("Expected output %q, got %q", tt.expected, output)
+			}
+			if more != tt.more {
+				t.Errorf("Expected more=%v, got %v", tt.more, more)
+			}
+		})
+	}
+}
+
+func TestREPL_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		expected []string
+		output   string
+	}{
+		{"syntax error", []string{"print 1;)"}, []string{
+			"[line 1, column 9] Error at ')': Expect expression.",
+		}, ""},
+		{"blank line abandons input", []string{"{ print 1;", ""}, []string{
+			"[line 2, column 1] Error at end: Expect '}' after block.",
+		}, ""},
+		{"runtime error keeps session", []string{"var a = 1;", "a + nil", "print a;"}, []string{
+			"[line 1, column 3] Runtime error at '+': Operands must be two numbers or two strings.",
+		}, "1\n"},
+		{"resolve error", []string{"return 1;"}, []string{
+			"[line 1, column 1] Error at 'return': Can't return from top-level code.",
+		}, ""},
+		{"constant division by zero", []string{"print 1 / 0;", "print 2;"}, []string{
+			"[line 1, column 9] Error at '/': Division by zero.",
+		}, "2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errs, more := feedAll(tt.lines...)
+			if strings.Join(errs, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Expected errors:\n%s\nGot:\n%s", strings.Join(tt.expected, "\n"), strings.Join(errs, "\n"))
+			}
+			if output != tt.output {
+				t.Errorf("Expected output %q, got %q", tt.output, output)
+			}
+			if more {
+				t.Error("Expected the session to be ready for new input")
+			}
+		})
+	}
+}
+
+func TestREPL_Commands(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "lib.lox")
+	if err := os.WriteFile(script, []byte("fun double(x) { return x * 2; }\nvar loaded = true;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		lines    []string
+		expected string
+	}{
+		{"tokens", []string{":tokens print 1;"}, `{Type: PRINT, Lexeme: "print", Literal: <nil>, Line: 1, Column: 1}
+{Type: NUMBER, Lexeme: "1", Literal: 1, Line: 1, Column: 7}
+{Type: SEMICOLON, Lexeme: ";", Literal: <nil>, Line: 1, Column: 8}
+{Type: EOF, Lexeme: "", Literal: <nil>, Line: 1, Column: 9}
+`},
+		{"ast expression", []string{":ast 1 + 2 * 3"}, "(+ 1 (* 2 3))\n"},
+		{"ast statements", []string{":ast var a = 1; print a;"}, "(var a 1)\n(print a)\n"},
+		{"env", []string{"var b = \"x\";", "var a = 1.5;", ":env"}, "a = 1.5\nb = x\nclock = <native fn>\n"},
+		{"load", []string{":load " + script, "double(21)", "loaded"}, "42\ntrue\n"},
+		{"reset", []string{"var a = 1;", ":reset", ":env"}, "clock = <native fn>\n"},
+		{"unknown", []string{":nope"}, "Unknown command ':nope'. Type :help for a list of commands.\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errs, _ := feedAll(tt.lines...)
+			if len(errs) > 0 {
+				t.Fatalf("Unexpected errors: %v", errs)
+			}
+			if output != tt.expected {
+				t.Errorf("Expected output:\n%s\nGot:\n%s", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestREPL_Quit(t *testing.T) {
+	r := newREPL(io.Discard)
+	r.feed(":quit")
+	if !r.done {
+		t.Error("Expected :quit to end the session")
+	}
+}
+
+func TestREPL_Complete(t *testing.T) {
+	r := newREPL(io.Discard)
+	r.feed("var printer = 1;")
+	r.feed("fun cloud() {}")
+
+	tests := []struct {
+		word     string
+		expected []string
+	}{
+		{"pri", []string{"print", "printer"}},
+		{"cl", []string{"class", "clock", "cloud"}},
+		{"lo", []string{"load"}},
+		{"zz", nil},
+	}
+	for _, tt := range tests {
+		if got := r.complete(tt.word); strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("complete(%q): expected %v, got %v", tt.word, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/interpreter"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/optimizer"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/resolver"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/vm"
+)
+
+// reportErrors writes the errors carried by err to stderr in the format
+// selected with --diagnostics.
+func reportErrors(filename string, source string, err error) {
+	switch *diagnosticsFormat {
+	case "plain":
+		writePlain(os.Stderr, err)
+	case "json":
+		if err := diagnostics.WriteJSON(os.Stderr, filename, diagnostics.FromError(err)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+	default:
+		writeText(os.Stderr, source, err)
+	}
+}
+
+// writeText renders each error with its source snippet, followed by the Lox
+// stack trace for runtime errors. Errors without position information are
+// printed as plain text.
+func writeText(w *os.File, source string, err error) {
+	ds := diagnostics.FromError(err)
+	if len(ds) == 0 {
+		fmt.Fprintln(w, "Error:", err)
+		return
+	}
+	diagnostics.NewRenderer(w, source, useColor(w)).RenderAll(ds)
+
+	if stack := stackTrace(err); len(stack) > 0 {
+		fmt.Fprintln(w, interpreter.Traceback(stack))
+	}
+}
+
+// stackTrace returns the Lox stack trace of a runtime error from either
+// engine, or nil for other errors.
+func stackTrace(err error) []interpreter.Frame {
+	var runtimeErr *interpreter.RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr.Stack
+	}
+	var vmErr *vm.RuntimeError
+	if errors.As(err, &vmErr) {
+		return vmErr.Stack
+	}
+	return nil
+}
+
+// writePlain prints errors exactly as the reference Lox implementation does,
+// which is what the upstream test suite matches against:
+//
+//	[line 1] Error: Unexpected character.
+//	[line 1] Error at 'x': Expect ';' after value.
+//	Operands must be numbers.
+//	[line 1]
+func writePlain(w io.Writer, err error) {
+	switch e := err.(type) {
+	case *scanner.Error:
+		fmt.Fprintf(w, "[line %d] Error: %s\n", e.Line, e.Message)
+	case *parser.Error:
+		writePlainAt(w, e.Token, e.Message)
+	case *resolver.Error:
+		writePlainAt(w, e.Token, e.Message)
+	case *optimizer.Error:
+		writePlainAt(w, e.Token, e.Message)
+	case *vm.CompileError:
+		writePlainAt(w, e.Token, e.Message)
+	case *interpreter.RuntimeError:
+		fmt.Fprintf(w, "%s\n[line %d]\n", e.Message, e.Token.Line)
+	case *vm.RuntimeError:
+		fmt.Fprintf(w, "%s\n[line %d]\n", e.Message, e.Line)
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			writePlain(w, inner)
+		}
+	default:
+		fmt.Fprintln(w, err)
+	}
+}
+
+func writePlainAt(w io.Writer, token scanner.Token, message string) {
+	if token.Type == scanner.EOF {
+		fmt.Fprintf(w, "[line %d] Error at end: %s\n", token.Line, message)
+		return
+	}
+	fmt.Fprintf(w, "[line %d] Error at '%s': %s\n", token.Line, token.Lexeme, message)
+}
+
+// useColor reports whether colored output should be written to f.
+func useColor(f *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && isTerminal(f)
+}
+
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
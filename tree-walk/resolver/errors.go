@@ -0,0 +1,27 @@
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+)
+
+// Error is a static error found by the resolver.
+type Error struct {
+	Code    diagnostics.Code
+	Token   scanner.Token
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Token.Type == scanner.EOF {
+		return fmt.Sprintf("[line %d, column %d] Error at end: %s", e.Token.Line, e.Token.Column, e.Message)
+	}
+	return fmt.Sprintf("[line %d, column %d] Error at '%s': %s", e.Token.Line, e.Token.Column, e.Token.Lexeme, e.Message)
+}
+
+// Diagnostic describes the error as pointing at the offending token.
+func (e *Error) Diagnostic() diagnostics.Diagnostic {
+	return diagnostics.Diagnostic{Severity: diagnostics.Error, Code: e.Code, Span: e.Token.Span(), Message: e.Message}
+}
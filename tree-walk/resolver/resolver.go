@@ -0,0 +1,314 @@
+package resolver
+
+import (
+	"errors"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+)
+
+// Interpreter receives the scope depth of every resolved local variable.
+type Interpreter interface {
+	Resolve(expr parser.Expr, depth int)
+}
+
+type functionType int
+
+const (
+	functionNone functionType = iota
+	functionFunction
+	functionInitializer
+	functionMethod
+)
+
+type classType int
+
+const (
+	classNone classType = iota
+	classClass
+	classSubclass
+)
+
+// Resolver is a static pass over the AST that binds each variable reference
+// to the scope declaring it and reports scope errors before execution.
+type Resolver struct {
+	interpreter     Interpreter
+	scopes          []map[string]bool
+	currentFunction functionType
+	currentClass    classType
+	errors          []error
+}
+
+// NewResolver creates a resolver reporting bindings to interpreter. A nil
+// interpreter only checks the program for static errors, for backends that
+// resolve variables themselves.
+func NewResolver(interpreter Interpreter) *Resolver {
+	return &Resolver{interpreter: interpreter}
+}
+
+// Resolve walks the statements, reporting every static error found.
+func (r *Resolver) Resolve(statements []parser.Stmt) error {
+	r.errors = nil
+	r.resolveStatements(statements)
+	return errors.Join(r.errors...)
+}
+
+func (r *Resolver) resolveStatements(statements []parser.Stmt) {
+	for _, stmt := range statements {
+		r.resolveStmt(stmt)
+	}
+}
+
+func (r *Resolver) resolveStmt(stmt parser.Stmt) {
+	stmt.Accept(r)
+}
+
+func (r *Resolver) resolveExpr(expr parser.Expr) {
+	expr.Accept(r)
+}
+
+func (r *Resolver) resolveFunction(function *parser.FunctionStmt, kind functionType) {
+	enclosingFunction := r.currentFunction
+	r.currentFunction = kind
+
+	r.beginScope()
+	for _, param := range function.Params {
+		r.declare(param)
+		r.define(param)
+	}
+	r.resolveStatements(function.Body)
+	r.endScope()
+
+	r.currentFunction = enclosingFunction
+}
+
+func (r *Resolver) beginScope() {
+	r.scopes = append(r.scopes, map[string]bool{})
+}
+
+func (r *Resolver) endScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+// declare adds name to the innermost scope, marked as not yet initialized.
+func (r *Resolver) declare(name scanner.Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	scope := r.scopes[len(r.scopes)-1]
+	if _, ok := scope[name.Lexeme]; ok {
+		r.error(name, diagnostics.DuplicateDeclaration, "Already a variable with this name in this scope.")
+	}
+	scope[name.Lexeme] = false
+}
+
+// define marks name as initialized and ready for use.
+func (r *Resolver) define(name scanner.Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	r.scopes[len(r.scopes)-1][name.Lexeme] = true
+}
+
+// resolveLocal tells the interpreter how many scopes lie between expr and the
+// declaration of name. Unresolved names are assumed to be globals.
+func (r *Resolver) resolveLocal(expr parser.Expr, name scanner.Token) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if _, ok := r.scopes[i][name.Lexeme]; ok {
+			if r.interpreter != nil {
+				r.interpreter.Resolve(expr, len(r.scopes)-1-i)
+			}
+			return
+		}
+	}
+}
+
+func (r *Resolver) error(token scanner.Token, code diagnostics.Code, message string) {
+	r.errors = append(r.errors, &Error{Code: code, Token: token, Message: message})
+}
+
+// Statement visitors.
+
+func (r *Resolver) VisitBlockStmt(stmt *parser.BlockStmt) (interface{}, error) {
+	r.beginScope()
+	r.resolveStatements(stmt.Statements)
+	r.endScope()
+	return nil, nil
+}
+
+func (r *Resolver) VisitClassStmt(stmt *parser.ClassStmt) (interface{}, error) {
+	enclosingClass := r.currentClass
+	r.currentClass = classClass
+
+	r.declare(stmt.Name)
+	r.define(stmt.Name)
+
+	if stmt.Superclass != nil {
+		if stmt.Superclass.Name.Lexeme == stmt.Name.Lexeme {
+			r.error(stmt.Superclass.Name, diagnostics.SelfInheritance, "A class can't inherit from itself.")
+		}
+		r.currentClass = classSubclass
+		r.resolveExpr(stmt.Superclass)
+
+		r.beginScope()
+		r.scopes[len(r.scopes)-1]["super"] = true
+	}
+
+	r.beginScope()
+	r.scopes[len(r.scopes)-1]["this"] = true
+	for _, method := range stmt.Methods {
+		kind := functionMethod
+		if method.Name.Lexeme == "init" {
+			kind = functionInitializer
+		}
+		r.resolveFunction(method, kind)
+	}
+	r.endScope()
+
+	if stmt.Superclass != nil {
+		r.endScope()
+	}
+
+	r.currentClass = enclosingClass
+	return nil, nil
+}
+
+func (r *Resolver) VisitVarStmt(stmt *parser.VarStmt) (interface{}, error) {
+	r.declare(stmt.Name)
+	if stmt.Initializer != nil {
+		r.resolveExpr(stmt.Initializer)
+	}
+	r.define(stmt.Name)
+	return nil, nil
+}
+
+func (r *Resolver) VisitFunctionStmt(stmt *parser.FunctionStmt) (interface{}, error) {
+	r.declare(stmt.Name)
+	r.define(stmt.Name)
+	r.resolveFunction(stmt, functionFunction)
+	return nil, nil
+}
+
+func (r *Resolver) VisitExpressionStmt(stmt *parser.ExpressionStmt) (interface{}, error) {
+	r.resolveExpr(stmt.Expression)
+	return nil, nil
+}
+
+func (r *Resolver) VisitIfStmt(stmt *parser.IfStmt) (interface{}, error) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		r.resolveStmt(stmt.ElseBranch)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitPrintStmt(stmt *parser.PrintStmt) (interface{}, error) {
+	r.resolveExpr(stmt.Expression)
+	return nil, nil
+}
+
+func (r *Resolver) VisitReturnStmt(stmt *parser.ReturnStmt) (interface{}, error) {
+	if r.currentFunction == functionNone {
+		r.error(stmt.Keyword, diagnostics.TopLevelReturn, "Can't return from top-level code.")
+	}
+	if stmt.Value != nil {
+		if r.currentFunction == functionInitializer {
+			r.error(stmt.Keyword, diagnostics.InitializerReturnValue, "Can't return a value from an initializer.")
+		}
+		r.resolveExpr(stmt.Value)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitWhileStmt(stmt *parser.WhileStmt) (interface{}, error) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.Body)
+	return nil, nil
+}
+
+// Expression visitors.
+
+func (r *Resolver) VisitVariableExpr(expr *parser.VariableExpr) (interface{}, error) {
+	if len(r.scopes) > 0 {
+		if defined, ok := r.scopes[len(r.scopes)-1][expr.Name.Lexeme]; ok && !defined {
+			r.error(expr.Name, diagnostics.ReadInOwnInitializer, "Can't read local variable in its own initializer.")
+		}
+	}
+	r.resolveLocal(expr, expr.Name)
+	return nil, nil
+}
+
+func (r *Resolver) VisitAssignExpr(expr *parser.AssignExpr) (interface{}, error) {
+	r.resolveExpr(expr.Value)
+	r.resolveLocal(expr, expr.Name)
+	return nil, nil
+}
+
+func (r *Resolver) VisitBinaryExpr(expr *parser.BinaryExpr) (interface{}, error) {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *Resolver) VisitCallExpr(expr *parser.CallExpr) (interface{}, error) {
+	r.resolveExpr(expr.Callee)
+	for _, argument := range expr.Arguments {
+		r.resolveExpr(argument)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitGetExpr(expr *parser.GetExpr) (interface{}, error) {
+	r.resolveExpr(expr.Object)
+	return nil, nil
+}
+
+func (r *Resolver) VisitSetExpr(expr *parser.SetExpr) (interface{}, error) {
+	r.resolveExpr(expr.Value)
+	r.resolveExpr(expr.Object)
+	return nil, nil
+}
+
+func (r *Resolver) VisitSuperExpr(expr *parser.SuperExpr) (interface{}, error) {
+	switch r.currentClass {
+	case classNone:
+		r.error(expr.Keyword, diagnostics.SuperOutsideClass, "Can't use 'super' outside of a class.")
+		return nil, nil
+	case classClass:
+		r.error(expr.Keyword, diagnostics.SuperWithoutSuperclass, "Can't use 'super' in a class with no superclass.")
+		return nil, nil
+	}
+	r.resolveLocal(expr, expr.Keyword)
+	return nil, nil
+}
+
+func (r *Resolver) VisitThisExpr(expr *parser.ThisExpr) (interface{}, error) {
+	if r.currentClass == classNone {
+		r.error(expr.Keyword, diagnostics.ThisOutsideClass, "Can't use 'this' outside of a class.")
+		return nil, nil
+	}
+	r.resolveLocal(expr, expr.Keyword)
+	return nil, nil
+}
+
+func (r *Resolver) VisitGroupingExpr(expr *parser.GroupingExpr) (interface{}, error) {
+	r.resolveExpr(expr.Expression)
+	return nil, nil
+}
+
+func (r *Resolver) VisitLiteralExpr(expr *parser.LiteralExpr) (interface{}, error) {
+	return nil, nil
+}
+
+func (r *Resolver) VisitLogicalExpr(expr *parser.LogicalExpr) (interface{}, error) {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *Resolver) VisitUnaryExpr(expr *parser.UnaryExpr) (interface{}, error) {
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
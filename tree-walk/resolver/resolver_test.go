@@ -0,0 +1,145 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+)
+
+// recordingInterpreter captures resolved depths keyed by variable name.
+type recordingInterpreter struct {
+	depths map[string][]int
+}
+
+func (r *recordingInterpreter) Resolve(expr parser.Expr, depth int) {
+	switch e := expr.(type) {
+	case *parser.VariableExpr:
+		r.depths[e.Name.Lexeme] = append(r.depths[e.Name.Lexeme], depth)
+	case *parser.AssignExpr:
+		r.depths[e.Name.Lexeme] = append(r.depths[e.Name.Lexeme], depth)
+	}
+}
+
+func TestResolver_Depths(t *testing.T) {
+	source := `var g = 1;
+{
+  var a = 1;
+  {
+    var b = a + g;
+    a = b;
+  }
+}
+fun f(p) { return p; }`
+
+	statements, err := parser.ParseProgram(scanTokens(t, source))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	interp := &recordingInterpreter{depths: map[string][]int{}}
+	if err := NewResolver(interp).Resolve(statements); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+
+	expected := map[string][]int{
+		"a": {1, 1},
+		"b": {0},
+		"p": {0},
+	}
+	for name, depths := range expected {
+		got := interp.depths[name]
+		if len(got) != len(depths) {
+			t.Errorf("Variable %s: expected depths %v, got %v", name, depths, got)
+			continue
+		}
+		for i := range depths {
+			if got[i] != depths[i] {
+				t.Errorf("Variable %s: expected depths %v, got %v", name, depths, got)
+				break
+			}
+		}
+	}
+	if _, ok := interp.depths["g"]; ok {
+		t.Errorf("Global g should not be resolved, got %v", interp.depths["g"])
+	}
+}
+
+func TestResolver_Errors(t *testing.T) {
+	tests := []struct {
+		source        string
+		expectedError string
+	}{
+		{
+			source:        "{ var a = a; }",
+			expectedError: "[line 1, column 11] Error at 'a': Can't read local variable in its own initializer.",
+		},
+		{
+			source:        "{ var a = 1;\nvar a = 2; }",
+			expectedError: "[line 2, column 5] Error at 'a': Already a variable with this name in this scope.",
+		},
+		{
+			source:        "fun f(a, a) {}",
+			expectedError: "[line 1, column 10] Error at 'a': Already a variable with this name in this scope.",
+		},
+		{
+			source:        "return 1;",
+			expectedError: "[line 1, column 1] Error at 'return': Can't return from top-level code.",
+		},
+		{
+			source:        "return;\n{ var b = b; }",
+			expectedError: "[line 1, column 1] Error at 'return': Can't return from top-level code.\n[line 2, column 11] Error at 'b': Can't read local variable in its own initializer.",
+		},
+		{
+			source:        "print this;",
+			expectedError: "[line 1, column 7] Error at 'this': Can't use 'this' outside of a class.",
+		},
+		{
+			source:        "fun f() { return this; }",
+			expectedError: "[line 1, column 18] Error at 'this': Can't use 'this' outside of a class.",
+		},
+		{
+			source:        "class A { init() { return 1; } }",
+			expectedError: "[line 1, column 20] Error at 'return': Can't return a value from an initializer.",
+		},
+		{
+			source:        "class A < A {}",
+			expectedError: "[line 1, column 11] Error at 'A': A class can't inherit from itself.",
+		},
+		{
+			source:        "super.method();",
+			expectedError: "[line 1, column 1] Error at 'super': Can't use 'super' outside of a class.",
+		},
+		{
+			source:        "class A { m() { super.m(); } }",
+			expectedError: "[line 1, column 17] Error at 'super': Can't use 'super' in a class with no superclass.",
+		},
+	}
+
+	for _, tt := range tests {
+		statements, err := parser.ParseProgram(scanTokens(t, tt.source))
+		if err != nil {
+			t.Errorf("Parse error for source: %s\nError: %v", tt.source, err)
+			continue
+		}
+
+		err = NewResolver(&recordingInterpreter{depths: map[string][]int{}}).Resolve(statements)
+		if err == nil {
+			t.Errorf("Expected resolve error for source: %s\nBut got none", tt.source)
+			continue
+		}
+
+		if err.Error() != tt.expectedError {
+			t.Errorf("Source: %s\nExpected Error: %s\nGot Error: %s", tt.source, tt.expectedError, err.Error())
+		}
+	}
+}
+
+func scanTokens(t *testing.T, source string) []scanner.Token {
+	t.Helper()
+	tokens, errs := scanner.ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Scan errors for source: %s\nErrors: %v", source, errs)
+	}
+	return tokens
+}
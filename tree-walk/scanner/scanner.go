@@ -2,7 +2,11 @@ package scanner
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
 )
 
 type TokenType int
@@ -119,100 +123,160 @@ var keywords = map[string]TokenType{
 	"while":  WHILE,
 }
 
+// Keywords returns the reserved words of the language in alphabetical order.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// Token is a single lexeme. Start and End are byte offsets into the source,
+// with End exclusive, and Column is the 1-based byte column of Start on Line.
 type Token struct {
 	Type    TokenType
 	Lexeme  string
 	Literal interface{}
 	Line    int
+	Column  int
+	Start   int
+	End     int
 }
 
 func (t Token) String() string {
-	return fmt.Sprintf("{Type: %s, Lexeme: %q, Literal: %v, Line: %d}", TokenTypeNames[t.Type], t.Lexeme, t.Literal, t.Line)
+	return fmt.Sprintf("{Type: %s, Lexeme: %q, Literal: %v, Line: %d, Column: %d}", TokenTypeNames[t.Type], t.Lexeme, t.Literal, t.Line, t.Column)
+}
+
+// Span returns the source range covered by the token.
+func (t Token) Span() diagnostics.Span {
+	return diagnostics.Span{Start: t.Start, End: t.End, Line: t.Line, Column: t.Column}
+}
+
+// Error is a lexical error found while scanning.
+type Error struct {
+	Code    diagnostics.Code
+	Line    int
+	Column  int
+	Offset  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("[line %d, column %d] Error: %s", e.Line, e.Column, e.Message)
+}
+
+// Diagnostic describes the error as pointing at the offending character.
+func (e *Error) Diagnostic() diagnostics.Diagnostic {
+	return diagnostics.Diagnostic{
+		Severity: diagnostics.Error,
+		Code:     e.Code,
+		Span:     diagnostics.Span{Start: e.Offset, End: e.Offset + 1, Line: e.Line, Column: e.Column},
+		Message:  e.Message,
+	}
 }
 
-func ScanTokens(source string) []Token {
+// Comment is a comment found while scanning. Comments are not tokens, but
+// they are kept so tools such as the formatter can reproduce them. Text
+// includes the comment delimiters.
+type Comment struct {
+	Text   string
+	Line   int
+	Column int
+	Start  int
+	End    int
+}
+
+// EndLine returns the line the comment ends on.
+func (c Comment) EndLine() int {
+	return c.Line + strings.Count(c.Text, "\n")
+}
+
+// ScanTokens splits source into tokens. Scanning continues past lexical
+// errors, which are returned in source order alongside the tokens that
+// could be recognized.
+func ScanTokens(source string) ([]Token, []error) {
+	tokens, _, errors := ScanTokensWithComments(source)
+	return tokens, errors
+}
+
+// ScanTokensWithComments is like ScanTokens but also returns the comments in
+// the source, in order.
+func ScanTokensWithComments(source string) ([]Token, []Comment, []error) {
 	var tokens []Token
+	var comments []Comment
+	var errors []error
 	currentPos, line := 0, 1
 
 	for currentPos < len(source) {
-		currentPos, line = scanAndAppendToken(source, &tokens, currentPos, line)
+		currentPos, line = scanAndAppendToken(source, &tokens, &comments, &errors, currentPos, line)
 	}
 
-	tokens = append(tokens, Token{Type: EOF, Line: line})
-	return tokens
+	tokens = append(tokens, makeToken(source, EOF, len(source), len(source), line, nil))
+	return tokens, comments, errors
 }
 
-func scanAndAppendToken(source string, tokens *[]Token, currentPos int, line int) (int, int) {
+func scanAndAppendToken(source string, tokens *[]Token, comments *[]Comment, errors *[]error, currentPos int, line int) (int, int) {
+	startPos := currentPos
 	char := source[currentPos]
+	currentPos++
 
 	switch char {
 	case '(':
-		*tokens = append(*tokens, Token{Type: LEFT_PAREN, Lexeme: string(char), Line: line})
-		currentPos++
+		*tokens = append(*tokens, makeToken(source, LEFT_PAREN, startPos, currentPos, line, nil))
 	case ')':
-		*tokens = append(*tokens, Token{Type: RIGHT_PAREN, Lexeme: string(char), Line: line})
-		currentPos++
+		*tokens = append(*tokens, makeToken(source, RIGHT_PAREN, startPos, currentPos, line, nil))
 	case '{':
-		*tokens = append(*tokens, Token{Type: LEFT_BRACE, Lexeme: string(char), Line: line})
-		currentPos++
+		*tokens = append(*tokens, makeToken(source, LEFT_BRACE, startPos, currentPos, line, nil))
 	case '}':
-		*tokens = append(*tokens, Token{Type: RIGHT_BRACE, Lexeme: string(char), Line: line})
-		currentPos++
+		*tokens = append(*tokens, makeToken(source, RIGHT_BRACE, startPos, currentPos, line, nil))
 	case ',':
-		*tokens = append(*tokens, Token{Type: COMMA, Lexeme: string(char), Line: line})
-		currentPos++
+		*tokens = append(*tokens, makeToken(source, COMMA, startPos, currentPos, line, nil))
 	case '.':
-		*tokens = append(*tokens, Token{Type: DOT, Lexeme: string(char), Line: line})
-		currentPos++
+		*tokens = append(*tokens, makeToken(source, DOT, startPos, currentPos, line, nil))
 	case '-':
-		*tokens = append(*tokens, Token{Type: MINUS, Lexeme: string(char), Line: line})
-		currentPos++
+		*tokens = append(*tokens, makeToken(source, MINUS, startPos, currentPos, line, nil))
 	case '+':
-		*tokens = append(*tokens, Token{Type: PLUS, Lexeme: string(char), Line: line})
-		currentPos++
+		*tokens = append(*tokens, makeToken(source, PLUS, startPos, currentPos, line, nil))
 	case ';':
-		*tokens = append(*tokens, Token{Type: SEMICOLON, Lexeme: string(char), Line: line})
-		currentPos++
+		*tokens = append(*tokens, makeToken(source, SEMICOLON, startPos, currentPos, line, nil))
 	case '*':
-		*tokens = append(*tokens, Token{Type: STAR, Lexeme: string(char), Line: line})
-		currentPos++
+		*tokens = append(*tokens, makeToken(source, STAR, startPos, currentPos, line, nil))
 	case '!':
-		currentPos++
+		tokenType := BANG
 		if match(source, &currentPos, '=') {
-			*tokens = append(*tokens, Token{Type: BANG_EQUAL, Lexeme: "!=", Line: line})
-		} else {
-			*tokens = append(*tokens, Token{Type: BANG, Lexeme: "!", Line: line})
+			tokenType = BANG_EQUAL
 		}
+		*tokens = append(*tokens, makeToken(source, tokenType, startPos, currentPos, line, nil))
 	case '=':
-		currentPos++
+		tokenType := EQUAL
 		if match(source, &currentPos, '=') {
-			*tokens = append(*tokens, Token{Type: EQUAL_EQUAL, Lexeme: "==", Line: line})
-		} else {
-			*tokens = append(*tokens, Token{Type: EQUAL, Lexeme: "=", Line: line})
+			tokenType = EQUAL_EQUAL
 		}
+		*tokens = append(*tokens, makeToken(source, tokenType, startPos, currentPos, line, nil))
 	case '<':
-		currentPos++
+		tokenType := LESS
 		if match(source, &currentPos, '=') {
-			*tokens = append(*tokens, Token{Type: LESS_EQUAL, Lexeme: "<=", Line: line})
-		} else {
-			*tokens = append(*tokens, Token{Type: LESS, Lexeme: "<", Line: line})
+			tokenType = LESS_EQUAL
 		}
+		*tokens = append(*tokens, makeToken(source, tokenType, startPos, currentPos, line, nil))
 	case '>':
-		currentPos++
+		tokenType := GREATER
 		if match(source, &currentPos, '=') {
-			*tokens = append(*tokens, Token{Type: GREATER_EQUAL, Lexeme: ">=", Line: line})
-		} else {
-			*tokens = append(*tokens, Token{Type: GREATER, Lexeme: ">", Line: line})
+			tokenType = GREATER_EQUAL
 		}
+		*tokens = append(*tokens, makeToken(source, tokenType, startPos, currentPos, line, nil))
 	case '/':
-		currentPos++
 		if match(source, &currentPos, '/') {
 			// Single-line comment
 			for peek(source, currentPos) != '\n' && currentPos < len(source) {
 				currentPos++
 			}
+			*comments = append(*comments, makeComment(source, startPos, currentPos, line))
 		} else if match(source, &currentPos, '*') {
 			// Multi-line comment
+			startLine := line
 			depth := 1
 			for depth > 0 && currentPos < len(source) {
 				if peek(source, currentPos) == '/' && peekNext(source, currentPos) == '*' {
@@ -231,28 +295,26 @@ func scanAndAppendToken(source string, tokens *[]Token, currentPos int, line int
 				}
 			}
 			if depth > 0 {
-				reportError(line, "Unterminated multi-line comment.")
-				panic("Unterminated multi-line comment.")
+				reportError(errors, diagnostics.UnterminatedComment, source, startPos, startLine, "Unterminated multi-line comment.")
+			} else {
+				*comments = append(*comments, makeComment(source, startPos, currentPos, startLine))
 			}
 		} else {
-			*tokens = append(*tokens, Token{Type: SLASH, Lexeme: "/", Line: line})
+			*tokens = append(*tokens, makeToken(source, SLASH, startPos, currentPos, line, nil))
 		}
 	case ' ', '\r', '\t':
 		// Ignore whitespace.
-		currentPos++
 	case '\n':
 		line++
-		currentPos++
 	case '"':
-		return scanString(source, tokens, currentPos, line)
+		return scanString(source, tokens, errors, startPos, line)
 	default:
 		if isDigit(char) {
-			return scanNumber(source, tokens, currentPos, line)
+			return scanNumber(source, tokens, errors, startPos, line)
 		} else if isAlpha(char) {
-			return scanIdentifier(source, tokens, currentPos, line)
+			return scanIdentifier(source, tokens, startPos, line)
 		} else {
-			reportError(line, fmt.Sprintf("Unexpected character: '%c'.", char))
-			panic("Unexpected character.")
+			reportError(errors, diagnostics.UnexpectedCharacter, source, startPos, line, "Unexpected character.")
 		}
 	}
 
@@ -271,12 +333,12 @@ func scanIdentifier(source string, tokens *[]Token, startPos int, line int) (int
 		tokenType = IDENTIFIER
 	}
 
-	*tokens = append(*tokens, Token{Type: tokenType, Lexeme: lexeme, Line: line})
+	*tokens = append(*tokens, makeToken(source, tokenType, startPos, currentPos, line, nil))
 
 	return currentPos, line
 }
 
-func scanNumber(source string, tokens *[]Token, startPos int, line int) (int, int) {
+func scanNumber(source string, tokens *[]Token, errors *[]error, startPos int, line int) (int, int) {
 	currentPos := startPos
 
 	// Integer part
@@ -284,33 +346,31 @@ func scanNumber(source string, tokens *[]Token, startPos int, line int) (int, in
 		currentPos++
 	}
 
-	// Fractional part
-	if currentPos < len(source) && source[currentPos] == '.' {
-		if currentPos+1 < len(source) && isDigit(source[currentPos+1]) {
-			currentPos++ // Consume '.'
-			for currentPos < len(source) && isDigit(source[currentPos]) {
-				currentPos++
-			}
-		} else {
-			// No digits after '.', invalid number
-			reportError(line, "Invalid number format: No digits after '.'.")
-			panic("Invalid number format.")
+	// Fractional part. A '.' not followed by a digit is left for the next
+	// token, so "12." scans as the number 12 followed by a DOT.
+	if currentPos+1 < len(source) && source[currentPos] == '.' && isDigit(source[currentPos+1]) {
+		currentPos++ // Consume '.'
+		for currentPos < len(source) && isDigit(source[currentPos]) {
+			currentPos++
 		}
 	}
 
 	lexeme := source[startPos:currentPos]
 	literalValue, err := strconv.ParseFloat(lexeme, 64)
 	if err != nil {
-		reportError(line, fmt.Sprintf("Invalid number literal: %s", lexeme))
-		panic("Invalid number literal.")
+		reportError(errors, diagnostics.InvalidNumber, source, startPos, line, fmt.Sprintf("Invalid number literal: %s", lexeme))
+		return currentPos, line
 	}
 
-	*tokens = append(*tokens, Token{Type: NUMBER, Lexeme: lexeme, Literal: literalValue, Line: line})
+	*tokens = append(*tokens, makeToken(source, NUMBER, startPos, currentPos, line, literalValue))
 
 	return currentPos, line
 }
 
-func scanString(source string, tokens *[]Token, startPos int, line int) (int, int) {
+// scanString scans a string literal, which may span several lines. The token,
+// or the error for an unterminated string, is reported where it starts.
+func scanString(source string, tokens *[]Token, errors *[]error, startPos int, line int) (int, int) {
+	startLine := line
 	currentPos := startPos + 1 // Move past the opening quote
 	for currentPos < len(source) && source[currentPos] != '"' {
 		if source[currentPos] == '\n' {
@@ -320,20 +380,49 @@ func scanString(source string, tokens *[]Token, startPos int, line int) (int, in
 	}
 
 	if currentPos >= len(source) {
-		reportError(line, "Unterminated string literal.")
-		panic("Unterminated string literal.")
+		reportError(errors, diagnostics.UnterminatedString, source, startPos, startLine, "Unterminated string.")
+		return currentPos, line
 	}
 
 	// Include the closing quote
 	currentPos++
-	lexeme := source[startPos:currentPos]
-	literal := lexeme[1 : len(lexeme)-1] // Exclude the surrounding quotes
+	literal := source[startPos+1 : currentPos-1] // Exclude the surrounding quotes
 
-	*tokens = append(*tokens, Token{Type: STRING, Lexeme: lexeme, Literal: literal, Line: line})
+	*tokens = append(*tokens, makeToken(source, STRING, startPos, currentPos, startLine, literal))
 
 	return currentPos, line
 }
 
+// makeToken builds the token spanning source[start:end].
+func makeToken(source string, tokenType TokenType, start int, end int, line int, literal interface{}) Token {
+	return Token{
+		Type:    tokenType,
+		Lexeme:  source[start:end],
+		Literal: literal,
+		Line:    line,
+		Column:  columnAt(source, start),
+		Start:   start,
+		End:     end,
+	}
+}
+
+// makeComment builds the comment spanning source[start:end], without the
+// carriage return of a CRLF line ending.
+func makeComment(source string, start int, end int, line int) Comment {
+	return Comment{
+		Text:   strings.TrimRight(source[start:end], "\r"),
+		Line:   line,
+		Column: columnAt(source, start),
+		Start:  start,
+		End:    end,
+	}
+}
+
+// columnAt returns the 1-based column of the byte at offset.
+func columnAt(source string, offset int) int {
+	return offset - strings.LastIndexByte(source[:offset], '\n')
+}
+
 func match(source string, current *int, expected byte) bool {
 	if *current >= len(source) {
 		return false
@@ -359,8 +448,10 @@ func peekNext(source string, current int) byte {
 	return source[current+1]
 }
 
-func reportError(line int, message string) {
-	fmt.Printf("[line %d] Error: %s\n", line, message)
+// reportError records a lexical error at the given offset. line is passed in
+// because the scanner already tracks it.
+func reportError(errors *[]error, code diagnostics.Code, source string, offset int, line int, message string) {
+	*errors = append(*errors, &Error{Code: code, Line: line, Column: columnAt(source, offset), Offset: offset, Message: message})
 }
 
 func isAlpha(c byte) bool {
@@ -22,7 +22,10 @@ func TestScanTokens(t *testing.T) {
 		{Type: EOF, Lexeme: "", Line: 2},
 	}
 
-	actualTokens := ScanTokens(source)
+	actualTokens, errs := ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected scan errors: %v", errs)
+	}
 
 	if len(actualTokens) != len(expectedTokens) {
 		t.Fatalf("Expected %d tokens, but got %d", len(expectedTokens), len(actualTokens))
@@ -63,7 +66,10 @@ This is a multi-line comment.
 		{Type: EOF, Lexeme: "", Line: 21}, // Adjust the line number based on the actual lines in your source.
 	}
 
-	actualTokens := ScanTokens(source)
+	actualTokens, errs := ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected scan errors: %v", errs)
+	}
 
 	if len(actualTokens) != len(expectedTokens) {
 		t.Fatalf("Expected %d tokens, but got %d", len(expectedTokens), len(actualTokens))
@@ -77,6 +83,35 @@ This is a multi-line comment.
 	}
 }
 
+func TestScanTokensRetainsComments(t *testing.T) {
+	source := "var a; // trailing\r\n/* block\n  /* nested */ */\nprint a; //"
+
+	tokens, comments, errs := ScanTokensWithComments(source)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected scan errors: %v", errs)
+	}
+	if len(tokens) != 7 {
+		t.Errorf("Expected comments to be left out of the tokens, got %v", tokens)
+	}
+
+	expected := []Comment{
+		{Text: "// trailing", Line: 1, Column: 8, Start: 7, End: 19},
+		{Text: "/* block\n  /* nested */ */", Line: 2, Column: 1, Start: 20, End: 46},
+		{Text: "//", Line: 4, Column: 10, Start: 56, End: 58},
+	}
+	if len(comments) != len(expected) {
+		t.Fatalf("Expected %d comments, got %d: %v", len(expected), len(comments), comments)
+	}
+	for i, c := range expected {
+		if comments[i] != c {
+			t.Errorf("Comment %d mismatch.\nExpected: %+v\nGot:      %+v", i, c, comments[i])
+		}
+	}
+	if comments[1].EndLine() != 3 {
+		t.Errorf("Expected block comment to end on line 3, got %d", comments[1].EndLine())
+	}
+}
+
 func TestScanTokensWithStringLiterals(t *testing.T) {
 	source := `"Hello, World!"
 "Another string with spaces and symbols! @#$$%^&*()"
@@ -89,7 +124,10 @@ func TestScanTokensWithStringLiterals(t *testing.T) {
 		{Type: EOF, Lexeme: "", Line: 3},
 	}
 
-	actualTokens := ScanTokens(source)
+	actualTokens, errs := ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected scan errors: %v", errs)
+	}
 
 	if len(actualTokens) != len(expectedTokens) {
 		t.Fatalf("Expected %d tokens, but got %d", len(expectedTokens), len(actualTokens))
@@ -111,7 +149,10 @@ func TestScanTokensWithBackslashes(t *testing.T) {
 		{Type: EOF, Lexeme: "", Line: 1},
 	}
 
-	actualTokens := ScanTokens(source)
+	actualTokens, errs := ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected scan errors: %v", errs)
+	}
 
 	if len(actualTokens) != len(expectedTokens) {
 		t.Fatalf("Expected %d tokens, but got %d", len(expectedTokens), len(actualTokens))
@@ -137,7 +178,10 @@ func TestScanTokensWithNumbers(t *testing.T) {
 		{Type: EOF, Lexeme: "", Line: 4},
 	}
 
-	actualTokens := ScanTokens(source)
+	actualTokens, errs := ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected scan errors: %v", errs)
+	}
 
 	if len(actualTokens) != len(expectedTokens) {
 		t.Fatalf("Expected %d tokens, but got %d", len(expectedTokens), len(actualTokens))
@@ -219,7 +263,37 @@ fun add(a, b) {
 		{Type: EOF, Lexeme: "", Line: 10},
 	}
 
-	actualTokens := ScanTokens(source)
+	actualTokens, errs := ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected scan errors: %v", errs)
+	}
+
+	if len(actualTokens) != len(expectedTokens) {
+		t.Fatalf("Expected %d tokens, but got %d", len(expectedTokens), len(actualTokens))
+	}
+
+	for i, expectedToken := range expectedTokens {
+		actualToken := actualTokens[i]
+		if !tokensEqual(expectedToken, actualToken) {
+			t.Errorf("Token %d mismatch.\nExpected: %v\nGot:      %v", i, expectedToken, actualToken)
+		}
+	}
+}
+
+func TestScanTokensTrailingDot(t *testing.T) {
+	source := "12.;"
+
+	expectedTokens := []Token{
+		{Type: NUMBER, Lexeme: "12", Literal: 12.0, Line: 1},
+		{Type: DOT, Lexeme: ".", Line: 1},
+		{Type: SEMICOLON, Lexeme: ";", Line: 1},
+		{Type: EOF, Lexeme: "", Line: 1},
+	}
+
+	actualTokens, errs := ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected scan errors: %v", errs)
+	}
 
 	if len(actualTokens) != len(expectedTokens) {
 		t.Fatalf("Expected %d tokens, but got %d", len(expectedTokens), len(actualTokens))
@@ -233,9 +307,118 @@ fun add(a, b) {
 	}
 }
 
+func TestScanTokensPositions(t *testing.T) {
+	source := "var s = \"a\nb\";\n/* one\ntwo */ s >= 1;"
+
+	expectedTokens := []Token{
+		{Type: VAR, Lexeme: "var", Line: 1, Column: 1, Start: 0, End: 3},
+		{Type: IDENTIFIER, Lexeme: "s", Line: 1, Column: 5, Start: 4, End: 5},
+		{Type: EQUAL, Lexeme: "=", Line: 1, Column: 7, Start: 6, End: 7},
+		{Type: STRING, Lexeme: "\"a\nb\"", Literal: "a\nb", Line: 1, Column: 9, Start: 8, End: 13},
+		{Type: SEMICOLON, Lexeme: ";", Line: 2, Column: 3, Start: 13, End: 14},
+		{Type: IDENTIFIER, Lexeme: "s", Line: 4, Column: 8, Start: 29, End: 30},
+		{Type: GREATER_EQUAL, Lexeme: ">=", Line: 4, Column: 10, Start: 31, End: 33},
+		{Type: NUMBER, Lexeme: "1", Literal: 1.0, Line: 4, Column: 13, Start: 34, End: 35},
+		{Type: SEMICOLON, Lexeme: ";", Line: 4, Column: 14, Start: 35, End: 36},
+		{Type: EOF, Lexeme: "", Line: 4, Column: 15, Start: 36, End: 36},
+	}
+
+	actualTokens, errs := ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected scan errors: %v", errs)
+	}
+
+	if len(actualTokens) != len(expectedTokens) {
+		t.Fatalf("Expected %d tokens, but got %d", len(expectedTokens), len(actualTokens))
+	}
+
+	for i, expectedToken := range expectedTokens {
+		actualToken := actualTokens[i]
+		if !tokensEqual(expectedToken, actualToken) ||
+			actualToken.Column != expectedToken.Column ||
+			actualToken.Start != expectedToken.Start ||
+			actualToken.End != expectedToken.End {
+			t.Errorf("Token %d mismatch.\nExpected: %v [%d:%d]\nGot:      %v [%d:%d]", i,
+				expectedToken, expectedToken.Start, expectedToken.End,
+				actualToken, actualToken.Start, actualToken.End)
+		}
+	}
+}
+
 func tokensEqual(a, b Token) bool {
 	return a.Type == b.Type &&
 		a.Lexeme == b.Lexeme &&
 		a.Line == b.Line &&
 		reflect.DeepEqual(a.Literal, b.Literal)
 }
+
+func TestScanTokensWithErrors(t *testing.T) {
+	source := `var a = 1 @ 2;
+/* unterminated`
+
+	expectedTokens := []Token{
+		{Type: VAR, Lexeme: "var", Line: 1},
+		{Type: IDENTIFIER, Lexeme: "a", Line: 1},
+		{Type: EQUAL, Lexeme: "=", Line: 1},
+		{Type: NUMBER, Lexeme: "1", Literal: 1.0, Line: 1},
+		{Type: NUMBER, Lexeme: "2", Literal: 2.0, Line: 1},
+		{Type: SEMICOLON, Lexeme: ";", Line: 1},
+		{Type: EOF, Lexeme: "", Line: 2},
+	}
+	expectedErrors := []string{
+		"[line 1, column 11] Error: Unexpected character.",
+		"[line 2, column 1] Error: Unterminated multi-line comment.",
+	}
+
+	actualTokens, errs := ScanTokens(source)
+
+	if len(actualTokens) != len(expectedTokens) {
+		t.Fatalf("Expected %d tokens, but got %d", len(expectedTokens), len(actualTokens))
+	}
+	for i, expectedToken := range expectedTokens {
+		actualToken := actualTokens[i]
+		if !tokensEqual(expectedToken, actualToken) {
+			t.Errorf("Token %d mismatch.\nExpected: %v\nGot:      %v", i, expectedToken, actualToken)
+		}
+	}
+
+	if len(errs) != len(expectedErrors) {
+		t.Fatalf("Expected %d errors, but got %d: %v", len(expectedErrors), len(errs), errs)
+	}
+	for i, expected := range expectedErrors {
+		if errs[i].Error() != expected {
+			t.Errorf("Error %d mismatch.\nExpected: %s\nGot:      %s", i, expected, errs[i].Error())
+		}
+	}
+}
+
+func TestScanTokensErrorRecovery(t *testing.T) {
+	tests := []struct {
+		source        string
+		expectedTypes []TokenType
+		expectedError string
+	}{
+		{"print \"open", []TokenType{PRINT, EOF}, "[line 1, column 7] Error: Unterminated string."},
+		{"#!", []TokenType{BANG, EOF}, "[line 1, column 1] Error: Unexpected character."},
+	}
+
+	for _, tt := range tests {
+		tokens, errs := ScanTokens(tt.source)
+		if len(errs) != 1 {
+			t.Errorf("Source: %s\nExpected 1 error, got %v", tt.source, errs)
+			continue
+		}
+		if errs[0].Error() != tt.expectedError {
+			t.Errorf("Source: %s\nExpected Error: %s\nGot Error: %s", tt.source, tt.expectedError, errs[0].Error())
+		}
+		if len(tokens) != len(tt.expectedTypes) {
+			t.Errorf("Source: %s\nExpected %d tokens, got %v", tt.source, len(tt.expectedTypes), tokens)
+			continue
+		}
+		for i, tokenType := range tt.expectedTypes {
+			if tokens[i].Type != tokenType {
+				t.Errorf("Source: %s\nToken %d: expected %s, got %s", tt.source, i, TokenTypeNames[tokenType], TokenTypeNames[tokens[i].Type])
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package value defines Value, the representation of Lox values shared by the
+// parser, the tree-walk interpreter and the bytecode VM.
+package value
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Kind is the type tag of a Value.
+type Kind uint8
+
+const (
+	KindNil Kind = iota
+	KindBool
+	KindNumber
+	KindObject
+)
+
+// Value is a Lox value: nil, a boolean, a number or an object. Numbers and
+// booleans are stored inline, so passing them around does not allocate the
+// way boxing a float64 in an interface{} does. Objects are strings and the
+// heap objects of the engines, such as functions, classes and instances.
+//
+// There is no separate kind field: object holds the object itself, nil for
+// the nil value, or one of the tags below for booleans and numbers. That
+// keeps a Value at three words.
+type Value struct {
+	number float64 // the number, or 1 for true and 0 for false
+	object interface{}
+}
+
+// tag marks a Value whose payload is stored in its number field. Pointers
+// to it fit in an interface{} without allocating.
+type tag struct{ kind Kind }
+
+var (
+	boolTag   = &tag{KindBool}
+	numberTag = &tag{KindNumber}
+)
+
+// Nil is the nil value, and also the zero Value.
+var Nil = Value{}
+
+// Bool returns a boolean value.
+func Bool(b bool) Value {
+	if b {
+		return Value{number: 1, object: boolTag}
+	}
+	return Value{object: boolTag}
+}
+
+// Number returns a number value.
+func Number(n float64) Value {
+	return Value{number: n, object: numberTag}
+}
+
+// String returns a string value.
+func String(s string) Value {
+	return Value{object: s}
+}
+
+// Object returns a value referring to a heap object, which should be a
+// pointer so that equality is identity. A nil object is the nil value.
+func Object(o interface{}) Value {
+	return Value{object: o}
+}
+
+// Of converts a Go value as produced by the scanner, nil, bool, float64 or
+// string, to a Value. Anything else is wrapped as an object.
+func Of(x interface{}) Value {
+	switch x := x.(type) {
+	case nil:
+		return Nil
+	case bool:
+		return Bool(x)
+	case float64:
+		return Number(x)
+	}
+	return Object(x)
+}
+
+// Kind returns the type tag of v.
+func (v Value) Kind() Kind {
+	switch o := v.object.(type) {
+	case nil:
+		return KindNil
+	case *tag:
+		return o.kind
+	}
+	return KindObject
+}
+
+func (v Value) IsNil() bool    { return v.object == nil }
+func (v Value) IsBool() bool   { return v.object == boolTag }
+func (v Value) IsNumber() bool { return v.object == numberTag }
+func (v Value) IsObject() bool { return v.Kind() == KindObject }
+
+// IsString reports whether v is a string.
+func (v Value) IsString() bool {
+	_, ok := v.object.(string)
+	return ok
+}
+
+// AsBool returns the boolean held by v, which must be a boolean.
+func (v Value) AsBool() bool { return v.number != 0 }
+
+// AsNumber returns the number held by v, which must be a number.
+func (v Value) AsNumber() float64 { return v.number }
+
+// AsString returns the string held by v and whether v is a string.
+func (v Value) AsString() (string, bool) {
+	s, ok := v.object.(string)
+	return s, ok
+}
+
+// AsObject returns the object v refers to, or nil if v is not an object.
+func (v Value) AsObject() interface{} {
+	if _, tagged := v.object.(*tag); tagged {
+		return nil
+	}
+	return v.object
+}
+
+// Interface returns v as a plain Go value: nil, bool, float64, string or the
+// object itself.
+func (v Value) Interface() interface{} {
+	switch v.object {
+	case boolTag:
+		return v.AsBool()
+	case numberTag:
+		return v.number
+	}
+	return v.object
+}
+
+// Truthy reports whether v counts as true in a condition: everything except
+// nil and false does.
+func (v Value) Truthy() bool {
+	switch v.object {
+	case nil:
+		return false
+	case boolTag:
+		return v.AsBool()
+	}
+	return true
+}
+
+// Equal reports whether two values are equal in Lox: values of different
+// kinds never are, strings compare by contents and other objects by
+// identity.
+func (v Value) Equal(w Value) bool {
+	// The number field is zero for nil and objects, so comparing both
+	// fields covers every kind.
+	return v.object == w.object && v.number == w.number
+}
+
+// String formats v the way print shows it. nil prints as "nil", whole
+// numbers print without a decimal point and other numbers print in their
+// shortest exact decimal form, switching to exponent notation only for very
+// large or very small magnitudes.
+func (v Value) String() string {
+	switch v.object {
+	case nil:
+		return "nil"
+	case boolTag:
+		return strconv.FormatBool(v.AsBool())
+	case numberTag:
+		return formatNumber(v.number)
+	}
+	if s, ok := v.object.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v.object)
+}
+
+func formatNumber(n float64) string {
+	switch {
+	case math.IsNaN(n):
+		return "NaN"
+	case math.IsInf(n, 1):
+		return "Infinity"
+	case math.IsInf(n, -1):
+		return "-Infinity"
+	}
+
+	abs := math.Abs(n)
+	if n == math.Trunc(n) && abs < 1e21 {
+		return strconv.FormatFloat(n, 'f', 0, 64)
+	}
+	if abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
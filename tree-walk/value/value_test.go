@@ -0,0 +1,111 @@
+package value
+
+import (
+	"math"
+	"testing"
+	"unsafe"
+)
+
+func TestValue_String(t *testing.T) {
+	tests := []struct {
+		value    Value
+		expected string
+	}{
+		{Nil, "nil"},
+		{Bool(true), "true"},
+		{Bool(false), "false"},
+		{String("text"), "text"},
+		{Number(1.0), "1"},
+		{Number(0), "0"},
+		{Number(math.Copysign(0, -1)), "-0"},
+		{Number(123456789.0), "123456789"},
+		{Number(1e20), "100000000000000000000"},
+		{Number(1e21), "1e+21"},
+		{Number(123.456), "123.456"},
+		{Number(-0.001), "-0.001"},
+		{Number(0.30000000000000004), "0.30000000000000004"},
+		{Number(1234567.5), "1234567.5"},
+		{Number(1e-7), "1e-07"},
+		{Number(math.NaN()), "NaN"},
+		{Number(math.Inf(1)), "Infinity"},
+		{Number(math.Inf(-1)), "-Infinity"},
+		{Object(&object{"obj"}), "obj"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.value.String(); got != tt.expected {
+			t.Errorf("%#v: expected %q, got %q", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestValue_Equal(t *testing.T) {
+	a, b := &object{"a"}, &object{"a"}
+	tests := []struct {
+		x, y     Value
+		expected bool
+	}{
+		{Nil, Nil, true},
+		{Nil, Bool(false), false},
+		{Bool(true), Bool(true), true},
+		{Bool(true), Number(1), false},
+		{Number(1), Number(1), true},
+		{Number(math.NaN()), Number(math.NaN()), false},
+		{String("a"), String("a"), true},
+		{String("a"), String("b"), false},
+		{Object(a), Object(a), true},
+		{Object(a), Object(b), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.x.Equal(tt.y); got != tt.expected {
+			t.Errorf("%v == %v: expected %v, got %v", tt.x, tt.y, tt.expected, got)
+		}
+	}
+}
+
+func TestValue_Truthy(t *testing.T) {
+	for _, v := range []Value{Bool(true), Number(0), String(""), Object(&object{})} {
+		if !v.Truthy() {
+			t.Errorf("Expected %v to be truthy", v)
+		}
+	}
+	for _, v := range []Value{Nil, Bool(false)} {
+		if v.Truthy() {
+			t.Errorf("Expected %v to be falsey", v)
+		}
+	}
+}
+
+func TestOf(t *testing.T) {
+	for _, x := range []interface{}{nil, true, false, 1.5, "s"} {
+		if got := Of(x).Interface(); got != x {
+			t.Errorf("Of(%v).Interface(): got %v", x, got)
+		}
+	}
+}
+
+func TestAllocations(t *testing.T) {
+	allocs := testing.AllocsPerRun(100, func() {
+		v := Number(1)
+		for i := 0; i < 100; i++ {
+			v = Number(v.AsNumber() + 1)
+		}
+		sink = v
+	})
+	if allocs != 0 {
+		t.Errorf("Expected number arithmetic not to allocate, got %v allocations", allocs)
+	}
+}
+
+func TestSize(t *testing.T) {
+	if size := unsafe.Sizeof(Value{}); size > 24 {
+		t.Errorf("Expected a Value to take at most 24 bytes, got %d", size)
+	}
+}
+
+var sink Value
+
+type object struct{ name string }
+
+func (o *object) String() string { return o.name }
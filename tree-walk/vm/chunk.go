@@ -0,0 +1,89 @@
+package vm
+
+import (
+	"math"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+// OpCode is a bytecode instruction. Operands follow the opcode in the code
+// stream; their sizes are given next to each instruction.
+type OpCode byte
+
+const (
+	OpConstant     OpCode = iota // u16 constant index
+	OpNil                        //
+	OpTrue                       //
+	OpFalse                      //
+	OpPop                        //
+	OpGetLocal                   // u8 stack slot
+	OpSetLocal                   // u8 stack slot
+	OpGetGlobal                  // u16 name constant
+	OpDefineGlobal               // u16 name constant
+	OpSetGlobal                  // u16 name constant
+	OpGetUpvalue                 // u8 upvalue index
+	OpSetUpvalue                 // u8 upvalue index
+	OpGetProperty                // u16 name constant
+	OpSetProperty                // u16 name constant
+	OpGetSuper                   // u16 name constant
+	OpEqual                      //
+	OpGreater                    //
+	OpLess                       //
+	OpGreaterEqual               //
+	OpLessEqual                  //
+	OpAdd                        //
+	OpSubtract                   //
+	OpMultiply                   //
+	OpDivide                     //
+	OpNot                        //
+	OpNegate                     //
+	OpPrint                      //
+	OpJump                       // u16 forward offset
+	OpJumpIfFalse                // u16 forward offset
+	OpLoop                       // u16 backward offset
+	OpCall                       // u8 argument count
+	OpInvoke                     // u16 name constant, u8 argument count
+	OpSuperInvoke                // u16 name constant, u8 argument count
+	OpClosure                    // u16 function constant, then u8 is-local and u8 index per upvalue
+	OpCloseUpvalue               //
+	OpReturn                     //
+	OpClass                      // u16 name constant
+	OpInherit                    //
+	OpMethod                     // u16 name constant
+)
+
+// Chunk is a compiled sequence of instructions with the constants they
+// refer to. Lines holds the source line of every byte in Code, so errors
+// can be reported against the source.
+type Chunk struct {
+	Code      []byte
+	Constants []value.Value
+	Lines     []int
+}
+
+func (c *Chunk) write(b byte, line int) {
+	c.Code = append(c.Code, b)
+	c.Lines = append(c.Lines, line)
+}
+
+// addConstant adds value to the constant pool and returns its index,
+// reusing an existing entry for equal strings and numbers. Numbers are
+// compared bit for bit, so 0 and -0 stay distinct.
+func (c *Chunk) addConstant(v value.Value) int {
+	if s, isString := v.AsString(); isString {
+		for i, constant := range c.Constants {
+			if cs, ok := constant.AsString(); ok && cs == s {
+				return i
+			}
+		}
+	} else if v.IsNumber() {
+		bits := math.Float64bits(v.AsNumber())
+		for i, constant := range c.Constants {
+			if constant.IsNumber() && math.Float64bits(constant.AsNumber()) == bits {
+				return i
+			}
+		}
+	}
+	c.Constants = append(c.Constants, v)
+	return len(c.Constants) - 1
+}
@@ -0,0 +1,612 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+// Limits imposed by the size of instruction operands.
+const (
+	maxLocals    = 256
+	maxUpvalues  = 256
+	maxConstants = 1 << 16
+	maxJump      = 1<<16 - 1
+)
+
+type functionKind int
+
+const (
+	kindScript functionKind = iota
+	kindFunction
+	kindMethod
+	kindInitializer
+)
+
+type local struct {
+	name       string
+	depth      int
+	isCaptured bool
+}
+
+type upvalueRef struct {
+	index   byte
+	isLocal bool
+}
+
+// funcCompiler holds the state of the function being compiled. Functions
+// nest, so each one points at the function enclosing it.
+type funcCompiler struct {
+	enclosing  *funcCompiler
+	function   *Function
+	kind       functionKind
+	locals     []local
+	upvalues   []upvalueRef
+	scopeDepth int
+}
+
+// classCompiler tracks the class whose methods are being compiled.
+type classCompiler struct {
+	enclosing     *classCompiler
+	hasSuperclass bool
+}
+
+// Compiler translates a resolved AST into bytecode. It implements both
+// parser.ExprVisitor and parser.StmtVisitor.
+type Compiler struct {
+	current *funcCompiler
+	class   *classCompiler
+	ranges  map[parser.Stmt]parser.Range
+	token   scanner.Token // most recently visited token, used for line numbers
+}
+
+// Compile compiles a program into the function for its top-level script.
+// The program must have passed the resolver, which reports the static
+// errors the compiler relies on not seeing. ranges, as returned by
+// parser.ParseProgramWithRanges, give the lines of code that has no token of
+// its own, such as literals; it may be nil.
+func Compile(statements []parser.Stmt, ranges map[parser.Stmt]parser.Range) (function *Function, err error) {
+	c := &Compiler{ranges: ranges, token: scanner.Token{Line: 1}}
+	c.begin(kindScript, "")
+
+	defer func() {
+		if r := recover(); r != nil {
+			compileErr, ok := r.(*CompileError)
+			if !ok {
+				panic(r)
+			}
+			function, err = nil, compileErr
+		}
+	}()
+
+	for _, stmt := range statements {
+		c.statement(stmt)
+	}
+	return c.end(), nil
+}
+
+func (c *Compiler) begin(kind functionKind, name string) {
+	c.current = &funcCompiler{
+		enclosing: c.current,
+		function:  &Function{Name: name},
+		kind:      kind,
+	}
+	// Slot zero holds the function being called, or the receiver in methods.
+	receiver := ""
+	if kind == kindMethod || kind == kindInitializer {
+		receiver = "this"
+	}
+	c.current.locals = append(c.current.locals, local{name: receiver})
+}
+
+func (c *Compiler) end() *Function {
+	c.emitReturn()
+	function := c.current.function
+	c.current = c.current.enclosing
+	return function
+}
+
+func (c *Compiler) statement(stmt parser.Stmt) {
+	if r, ok := c.ranges[stmt]; ok {
+		c.token = r.First
+	}
+	stmt.Accept(c)
+}
+
+func (c *Compiler) expression(expr parser.Expr) {
+	expr.Accept(c)
+}
+
+func (c *Compiler) error(token scanner.Token, code diagnostics.Code, message string) {
+	panic(&CompileError{Code: code, Token: token, Message: message})
+}
+
+// Emitting bytecode
+
+func (c *Compiler) chunk() *Chunk {
+	return &c.current.function.Chunk
+}
+
+func (c *Compiler) emit(bytes ...byte) {
+	for _, b := range bytes {
+		c.chunk().write(b, c.token.Line)
+	}
+}
+
+func (c *Compiler) emitOp(op OpCode, operands ...byte) {
+	c.emit(byte(op))
+	c.emit(operands...)
+}
+
+func (c *Compiler) emitShort(op OpCode, operand int) {
+	c.emit(byte(op), byte(operand>>8), byte(operand))
+}
+
+func (c *Compiler) emitReturn() {
+	if c.current.kind == kindInitializer {
+		c.emitOp(OpGetLocal, 0)
+	} else {
+		c.emitOp(OpNil)
+	}
+	c.emitOp(OpReturn)
+}
+
+func (c *Compiler) makeConstant(v value.Value) int {
+	index := c.chunk().addConstant(v)
+	if index >= maxConstants {
+		c.error(c.token, diagnostics.TooManyConstants, "Too many constants in one chunk.")
+	}
+	return index
+}
+
+func (c *Compiler) emitConstant(v value.Value) {
+	c.emitShort(OpConstant, c.makeConstant(v))
+}
+
+// emitJump emits a jump with a placeholder offset and returns the position
+// of the offset for patchJump.
+func (c *Compiler) emitJump(op OpCode) int {
+	c.emitShort(op, 0xffff)
+	return len(c.chunk().Code) - 2
+}
+
+func (c *Compiler) patchJump(offset int) {
+	jump := len(c.chunk().Code) - offset - 2
+	if jump > maxJump {
+		c.error(c.token, diagnostics.JumpTooLarge, "Too much code to jump over.")
+	}
+	c.chunk().Code[offset] = byte(jump >> 8)
+	c.chunk().Code[offset+1] = byte(jump)
+}
+
+func (c *Compiler) emitLoop(loopStart int) {
+	offset := len(c.chunk().Code) - loopStart + 3
+	if offset > maxJump {
+		c.error(c.token, diagnostics.JumpTooLarge, "Loop body too large.")
+	}
+	c.emitShort(OpLoop, offset)
+}
+
+// Scopes and variables
+
+func (c *Compiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+func (c *Compiler) endScope() {
+	fn := c.current
+	fn.scopeDepth--
+	for len(fn.locals) > 0 && fn.locals[len(fn.locals)-1].depth > fn.scopeDepth {
+		if fn.locals[len(fn.locals)-1].isCaptured {
+			c.emitOp(OpCloseUpvalue)
+		} else {
+			c.emitOp(OpPop)
+		}
+		fn.locals = fn.locals[:len(fn.locals)-1]
+	}
+}
+
+func (c *Compiler) addLocal(name scanner.Token) {
+	if len(c.current.locals) == maxLocals {
+		c.error(name, diagnostics.TooManyLocals, "Too many local variables in function.")
+	}
+	c.current.locals = append(c.current.locals, local{name: name.Lexeme, depth: c.current.scopeDepth})
+}
+
+// defineVariable binds the value on top of the stack to name, as a new local
+// in a block or function and as a global at the top level.
+func (c *Compiler) defineVariable(name scanner.Token) {
+	if c.current.scopeDepth > 0 {
+		c.addLocal(name)
+		return
+	}
+	c.emitShort(OpDefineGlobal, c.makeConstant(value.String(name.Lexeme)))
+}
+
+func resolveLocal(fn *funcCompiler, name string) int {
+	for i := len(fn.locals) - 1; i >= 0; i-- {
+		if fn.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Compiler) resolveUpvalue(fn *funcCompiler, name scanner.Token) int {
+	if fn.enclosing == nil {
+		return -1
+	}
+	if slot := resolveLocal(fn.enclosing, name.Lexeme); slot != -1 {
+		fn.enclosing.locals[slot].isCaptured = true
+		return c.addUpvalue(fn, name, byte(slot), true)
+	}
+	if index := c.resolveUpvalue(fn.enclosing, name); index != -1 {
+		return c.addUpvalue(fn, name, byte(index), false)
+	}
+	return -1
+}
+
+func (c *Compiler) addUpvalue(fn *funcCompiler, name scanner.Token, index byte, isLocal bool) int {
+	for i, upvalue := range fn.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return i
+		}
+	}
+	if len(fn.upvalues) == maxUpvalues {
+		c.error(name, diagnostics.TooManyUpvalues, "Too many closure variables in function.")
+	}
+	fn.upvalues = append(fn.upvalues, upvalueRef{index: index, isLocal: isLocal})
+	fn.function.UpvalueCount = len(fn.upvalues)
+	return len(fn.upvalues) - 1
+}
+
+// namedVariable emits a read of name, or a write of the value on top of the
+// stack when set is true.
+func (c *Compiler) namedVariable(name scanner.Token, set bool) {
+	c.token = name
+	getOp, setOp := OpGetLocal, OpSetLocal
+	index := resolveLocal(c.current, name.Lexeme)
+	if index == -1 {
+		if index = c.resolveUpvalue(c.current, name); index != -1 {
+			getOp, setOp = OpGetUpvalue, OpSetUpvalue
+		}
+	}
+
+	op := getOp
+	if set {
+		op = setOp
+	}
+	if index != -1 {
+		c.emitOp(op, byte(index))
+		return
+	}
+
+	op = OpGetGlobal
+	if set {
+		op = OpSetGlobal
+	}
+	c.emitShort(op, c.makeConstant(value.String(name.Lexeme)))
+}
+
+func (c *Compiler) function(declaration *parser.FunctionStmt, kind functionKind) {
+	c.begin(kind, declaration.Name.Lexeme)
+	c.beginScope()
+	for _, param := range declaration.Params {
+		c.addLocal(param)
+	}
+	c.current.function.Arity = len(declaration.Params)
+	for _, stmt := range declaration.Body {
+		c.statement(stmt)
+	}
+	upvalues := c.current.upvalues
+	function := c.end()
+
+	c.token = declaration.Name
+	c.emitShort(OpClosure, c.makeConstant(value.Object(function)))
+	for _, upvalue := range upvalues {
+		isLocal := byte(0)
+		if upvalue.isLocal {
+			isLocal = 1
+		}
+		c.emit(isLocal, upvalue.index)
+	}
+}
+
+// Statements
+
+// VisitExpressionStmt evaluates an expression and discards its value.
+func (c *Compiler) VisitExpressionStmt(stmt *parser.ExpressionStmt) (interface{}, error) {
+	c.expression(stmt.Expression)
+	c.emitOp(OpPop)
+	return nil, nil
+}
+
+// VisitPrintStmt prints the value of an expression.
+func (c *Compiler) VisitPrintStmt(stmt *parser.PrintStmt) (interface{}, error) {
+	c.expression(stmt.Expression)
+	c.emitOp(OpPrint)
+	return nil, nil
+}
+
+// VisitVarStmt declares a variable, nil unless it has an initializer.
+func (c *Compiler) VisitVarStmt(stmt *parser.VarStmt) (interface{}, error) {
+	c.token = stmt.Name
+	if stmt.Initializer != nil {
+		c.expression(stmt.Initializer)
+	} else {
+		c.emitOp(OpNil)
+	}
+	c.defineVariable(stmt.Name)
+	return nil, nil
+}
+
+// VisitBlockStmt compiles the statements of a block in a new scope.
+func (c *Compiler) VisitBlockStmt(stmt *parser.BlockStmt) (interface{}, error) {
+	c.beginScope()
+	for _, s := range stmt.Statements {
+		c.statement(s)
+	}
+	c.endScope()
+	return nil, nil
+}
+
+// VisitIfStmt compiles a conditional as a pair of forward jumps.
+func (c *Compiler) VisitIfStmt(stmt *parser.IfStmt) (interface{}, error) {
+	c.expression(stmt.Condition)
+	thenJump := c.emitJump(OpJumpIfFalse)
+	c.emitOp(OpPop)
+	c.statement(stmt.ThenBranch)
+	elseJump := c.emitJump(OpJump)
+	c.patchJump(thenJump)
+	c.emitOp(OpPop)
+	if stmt.ElseBranch != nil {
+		c.statement(stmt.ElseBranch)
+	}
+	c.patchJump(elseJump)
+	return nil, nil
+}
+
+// VisitWhileStmt compiles a loop that jumps back to its condition.
+func (c *Compiler) VisitWhileStmt(stmt *parser.WhileStmt) (interface{}, error) {
+	loopStart := len(c.chunk().Code)
+	c.expression(stmt.Condition)
+	exitJump := c.emitJump(OpJumpIfFalse)
+	c.emitOp(OpPop)
+	c.statement(stmt.Body)
+	c.emitLoop(loopStart)
+	c.patchJump(exitJump)
+	c.emitOp(OpPop)
+	return nil, nil
+}
+
+// VisitFunctionStmt compiles a function and binds its closure to its name.
+// Local functions are declared before their body so they can recurse.
+func (c *Compiler) VisitFunctionStmt(stmt *parser.FunctionStmt) (interface{}, error) {
+	if c.current.scopeDepth > 0 {
+		c.addLocal(stmt.Name)
+		c.function(stmt, kindFunction)
+		return nil, nil
+	}
+	c.function(stmt, kindFunction)
+	c.defineVariable(stmt.Name)
+	return nil, nil
+}
+
+// VisitReturnStmt returns from the current function.
+func (c *Compiler) VisitReturnStmt(stmt *parser.ReturnStmt) (interface{}, error) {
+	c.token = stmt.Keyword
+	if stmt.Value == nil {
+		c.emitReturn()
+		return nil, nil
+	}
+	c.expression(stmt.Value)
+	c.emitOp(OpReturn)
+	return nil, nil
+}
+
+// VisitClassStmt creates a class, copies in the superclass methods and then
+// attaches its own methods. The superclass is kept in a local named "super"
+// for the methods to capture.
+func (c *Compiler) VisitClassStmt(stmt *parser.ClassStmt) (interface{}, error) {
+	c.token = stmt.Name
+	c.emitShort(OpClass, c.makeConstant(value.String(stmt.Name.Lexeme)))
+	c.defineVariable(stmt.Name)
+
+	c.class = &classCompiler{enclosing: c.class}
+	defer func() { c.class = c.class.enclosing }()
+
+	if stmt.Superclass != nil {
+		c.namedVariable(stmt.Superclass.Name, false)
+		c.beginScope()
+		c.addLocal(scanner.Token{Type: scanner.SUPER, Lexeme: "super", Line: stmt.Superclass.Name.Line})
+		c.namedVariable(stmt.Name, false)
+		c.emitOp(OpInherit)
+		c.class.hasSuperclass = true
+	}
+
+	c.namedVariable(stmt.Name, false)
+	for _, method := range stmt.Methods {
+		kind := kindMethod
+		if method.Name.Lexeme == "init" {
+			kind = kindInitializer
+		}
+		c.function(method, kind)
+		c.emitShort(OpMethod, c.makeConstant(value.String(method.Name.Lexeme)))
+	}
+	c.emitOp(OpPop)
+
+	if c.class.hasSuperclass {
+		c.endScope()
+	}
+	return nil, nil
+}
+
+// Expressions
+
+// VisitLiteralExpr loads a constant.
+func (c *Compiler) VisitLiteralExpr(expr *parser.LiteralExpr) (interface{}, error) {
+	switch {
+	case expr.Value.IsNil():
+		c.emitOp(OpNil)
+	case expr.Value.IsBool() && expr.Value.AsBool():
+		c.emitOp(OpTrue)
+	case expr.Value.IsBool():
+		c.emitOp(OpFalse)
+	default:
+		c.emitConstant(expr.Value)
+	}
+	return nil, nil
+}
+
+// VisitGroupingExpr compiles the expression inside the parentheses.
+func (c *Compiler) VisitGroupingExpr(expr *parser.GroupingExpr) (interface{}, error) {
+	c.expression(expr.Expression)
+	return nil, nil
+}
+
+// VisitUnaryExpr compiles negation and logical not.
+func (c *Compiler) VisitUnaryExpr(expr *parser.UnaryExpr) (interface{}, error) {
+	c.expression(expr.Right)
+	c.token = expr.Operator
+	switch expr.Operator.Type {
+	case scanner.MINUS:
+		c.emitOp(OpNegate)
+	case scanner.BANG:
+		c.emitOp(OpNot)
+	}
+	return nil, nil
+}
+
+// VisitBinaryExpr compiles both operands followed by the operator.
+func (c *Compiler) VisitBinaryExpr(expr *parser.BinaryExpr) (interface{}, error) {
+	c.expression(expr.Left)
+	c.expression(expr.Right)
+	c.token = expr.Operator
+	switch expr.Operator.Type {
+	case scanner.PLUS:
+		c.emitOp(OpAdd)
+	case scanner.MINUS:
+		c.emitOp(OpSubtract)
+	case scanner.STAR:
+		c.emitOp(OpMultiply)
+	case scanner.SLASH:
+		c.emitOp(OpDivide)
+	case scanner.GREATER:
+		c.emitOp(OpGreater)
+	case scanner.GREATER_EQUAL:
+		c.emitOp(OpGreaterEqual)
+	case scanner.LESS:
+		c.emitOp(OpLess)
+	case scanner.LESS_EQUAL:
+		c.emitOp(OpLessEqual)
+	case scanner.EQUAL_EQUAL:
+		c.emitOp(OpEqual)
+	case scanner.BANG_EQUAL:
+		c.emitOp(OpEqual)
+		c.emitOp(OpNot)
+	default:
+		panic(fmt.Sprintf("vm: unknown binary operator %s", expr.Operator.Lexeme))
+	}
+	return nil, nil
+}
+
+// VisitLogicalExpr compiles "and" and "or" as short-circuiting jumps.
+func (c *Compiler) VisitLogicalExpr(expr *parser.LogicalExpr) (interface{}, error) {
+	c.expression(expr.Left)
+	c.token = expr.Operator
+	if expr.Operator.Type == scanner.AND {
+		endJump := c.emitJump(OpJumpIfFalse)
+		c.emitOp(OpPop)
+		c.expression(expr.Right)
+		c.patchJump(endJump)
+		return nil, nil
+	}
+
+	elseJump := c.emitJump(OpJumpIfFalse)
+	endJump := c.emitJump(OpJump)
+	c.patchJump(elseJump)
+	c.emitOp(OpPop)
+	c.expression(expr.Right)
+	c.patchJump(endJump)
+	return nil, nil
+}
+
+// VisitVariableExpr reads a variable.
+func (c *Compiler) VisitVariableExpr(expr *parser.VariableExpr) (interface{}, error) {
+	c.namedVariable(expr.Name, false)
+	return nil, nil
+}
+
+// VisitAssignExpr writes a variable, leaving the value on the stack.
+func (c *Compiler) VisitAssignExpr(expr *parser.AssignExpr) (interface{}, error) {
+	c.expression(expr.Value)
+	c.namedVariable(expr.Name, true)
+	return nil, nil
+}
+
+// VisitCallExpr compiles a call. Method calls on an instance or on super
+// use a single invoke instruction instead of creating a bound method.
+func (c *Compiler) VisitCallExpr(expr *parser.CallExpr) (interface{}, error) {
+	switch callee := expr.Callee.(type) {
+	case *parser.GetExpr:
+		c.expression(callee.Object)
+		c.arguments(expr.Arguments)
+		c.token = expr.Paren
+		c.emitShort(OpInvoke, c.makeConstant(value.String(callee.Name.Lexeme)))
+		c.emit(byte(len(expr.Arguments)))
+	case *parser.SuperExpr:
+		c.namedVariable(scanner.Token{Type: scanner.THIS, Lexeme: "this", Line: callee.Keyword.Line}, false)
+		c.arguments(expr.Arguments)
+		c.namedVariable(callee.Keyword, false)
+		c.token = expr.Paren
+		c.emitShort(OpSuperInvoke, c.makeConstant(value.String(callee.Method.Lexeme)))
+		c.emit(byte(len(expr.Arguments)))
+	default:
+		c.expression(expr.Callee)
+		c.arguments(expr.Arguments)
+		c.token = expr.Paren
+		c.emitOp(OpCall, byte(len(expr.Arguments)))
+	}
+	return nil, nil
+}
+
+func (c *Compiler) arguments(arguments []parser.Expr) {
+	for _, argument := range arguments {
+		c.expression(argument)
+	}
+}
+
+// VisitGetExpr reads a property.
+func (c *Compiler) VisitGetExpr(expr *parser.GetExpr) (interface{}, error) {
+	c.expression(expr.Object)
+	c.token = expr.Name
+	c.emitShort(OpGetProperty, c.makeConstant(value.String(expr.Name.Lexeme)))
+	return nil, nil
+}
+
+// VisitSetExpr writes a field, leaving the value on the stack.
+func (c *Compiler) VisitSetExpr(expr *parser.SetExpr) (interface{}, error) {
+	c.expression(expr.Object)
+	c.expression(expr.Value)
+	c.token = expr.Name
+	c.emitShort(OpSetProperty, c.makeConstant(value.String(expr.Name.Lexeme)))
+	return nil, nil
+}
+
+// VisitThisExpr reads the receiver.
+func (c *Compiler) VisitThisExpr(expr *parser.ThisExpr) (interface{}, error) {
+	c.namedVariable(expr.Keyword, false)
+	return nil, nil
+}
+
+// VisitSuperExpr reads a superclass method bound to the receiver.
+func (c *Compiler) VisitSuperExpr(expr *parser.SuperExpr) (interface{}, error) {
+	c.namedVariable(scanner.Token{Type: scanner.THIS, Lexeme: "this", Line: expr.Keyword.Line}, false)
+	c.namedVariable(expr.Keyword, false)
+	c.token = expr.Method
+	c.emitShort(OpGetSuper, c.makeConstant(value.String(expr.Method.Lexeme)))
+	return nil, nil
+}
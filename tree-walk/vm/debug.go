@@ -0,0 +1,143 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+var opNames = [...]string{
+	OpConstant:     "OP_CONSTANT",
+	OpNil:          "OP_NIL",
+	OpTrue:         "OP_TRUE",
+	OpFalse:        "OP_FALSE",
+	OpPop:          "OP_POP",
+	OpGetLocal:     "OP_GET_LOCAL",
+	OpSetLocal:     "OP_SET_LOCAL",
+	OpGetGlobal:    "OP_GET_GLOBAL",
+	OpDefineGlobal: "OP_DEFINE_GLOBAL",
+	OpSetGlobal:    "OP_SET_GLOBAL",
+	OpGetUpvalue:   "OP_GET_UPVALUE",
+	OpSetUpvalue:   "OP_SET_UPVALUE",
+	OpGetProperty:  "OP_GET_PROPERTY",
+	OpSetProperty:  "OP_SET_PROPERTY",
+	OpGetSuper:     "OP_GET_SUPER",
+	OpEqual:        "OP_EQUAL",
+	OpGreater:      "OP_GREATER",
+	OpLess:         "OP_LESS",
+	OpGreaterEqual: "OP_GREATER_EQUAL",
+	OpLessEqual:    "OP_LESS_EQUAL",
+	OpAdd:          "OP_ADD",
+	OpSubtract:     "OP_SUBTRACT",
+	OpMultiply:     "OP_MULTIPLY",
+	OpDivide:       "OP_DIVIDE",
+	OpNot:          "OP_NOT",
+	OpNegate:       "OP_NEGATE",
+	OpPrint:        "OP_PRINT",
+	OpJump:         "OP_JUMP",
+	OpJumpIfFalse:  "OP_JUMP_IF_FALSE",
+	OpLoop:         "OP_LOOP",
+	OpCall:         "OP_CALL",
+	OpInvoke:       "OP_INVOKE",
+	OpSuperInvoke:  "OP_SUPER_INVOKE",
+	OpClosure:      "OP_CLOSURE",
+	OpCloseUpvalue: "OP_CLOSE_UPVALUE",
+	OpReturn:       "OP_RETURN",
+	OpClass:        "OP_CLASS",
+	OpInherit:      "OP_INHERIT",
+	OpMethod:       "OP_METHOD",
+}
+
+func (op OpCode) String() string {
+	if int(op) < len(opNames) && opNames[op] != "" {
+		return opNames[op]
+	}
+	return fmt.Sprintf("OP_UNKNOWN(%d)", byte(op))
+}
+
+// Disassemble writes a listing of the function's chunk followed by the
+// listings of the functions it declares:
+//
+//	== <script> ==
+//	0000    1 OP_CONSTANT         0 '1'
+//	0003    | OP_PRINT
+//
+// Each instruction shows its offset, its source line ("|" when unchanged from
+// the previous instruction), its opcode and its operands.
+func Disassemble(w io.Writer, function *Function) {
+	fmt.Fprintf(w, "== %s ==\n", function)
+	for offset := 0; offset < len(function.Chunk.Code); {
+		offset = DisassembleInstruction(w, &function.Chunk, offset)
+	}
+	for _, constant := range function.Chunk.Constants {
+		if nested, ok := constant.AsObject().(*Function); ok {
+			fmt.Fprintln(w)
+			Disassemble(w, nested)
+		}
+	}
+}
+
+// DisassembleInstruction writes the instruction at offset and returns the
+// offset of the next instruction.
+func DisassembleInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
+	if offset > 0 && chunk.Lines[offset] == chunk.Lines[offset-1] {
+		fmt.Fprint(w, "   | ")
+	} else {
+		fmt.Fprintf(w, "%4d ", chunk.Lines[offset])
+	}
+
+	op := OpCode(chunk.Code[offset])
+	switch op {
+	case OpConstant, OpGetGlobal, OpDefineGlobal, OpSetGlobal, OpGetProperty, OpSetProperty, OpGetSuper, OpClass, OpMethod:
+		index := chunk.short(offset + 1)
+		fmt.Fprintf(w, "%-16s %4d '%s'\n", op, index, chunk.Constants[index])
+		return offset + 3
+	case OpGetLocal, OpSetLocal, OpGetUpvalue, OpSetUpvalue, OpCall:
+		fmt.Fprintf(w, "%-16s %4d\n", op, chunk.Code[offset+1])
+		return offset + 2
+	case OpJump, OpJumpIfFalse:
+		fmt.Fprintf(w, "%-16s %4d -> %d\n", op, offset, offset+3+chunk.short(offset+1))
+		return offset + 3
+	case OpLoop:
+		fmt.Fprintf(w, "%-16s %4d -> %d\n", op, offset, offset+3-chunk.short(offset+1))
+		return offset + 3
+	case OpInvoke, OpSuperInvoke:
+		index := chunk.short(offset + 1)
+		fmt.Fprintf(w, "%-16s (%d args) %4d '%s'\n", op, chunk.Code[offset+3], index, chunk.Constants[index])
+		return offset + 4
+	case OpClosure:
+		index := chunk.short(offset + 1)
+		function := chunk.Constants[index].AsObject().(*Function)
+		fmt.Fprintf(w, "%-16s %4d %s\n", op, index, function)
+		offset += 3
+		for i := 0; i < function.UpvalueCount; i++ {
+			kind := "upvalue"
+			if chunk.Code[offset] == 1 {
+				kind = "local"
+			}
+			fmt.Fprintf(w, "%04d    |                     %s %d\n", offset, kind, chunk.Code[offset+1])
+			offset += 2
+		}
+		return offset
+	}
+	fmt.Fprintln(w, op)
+	return offset + 1
+}
+
+// short reads the big-endian 16-bit operand at offset.
+func (c *Chunk) short(offset int) int {
+	return int(c.Code[offset])<<8 | int(c.Code[offset+1])
+}
+
+// traceStack formats the value stack for --trace-exec, bottom first.
+func traceStack(stack []value.Value) string {
+	var b strings.Builder
+	b.WriteString("          ")
+	for _, v := range stack {
+		fmt.Fprintf(&b, "[ %s ]", v)
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	source := `var a = 1;
+fun add(x) {
+  fun inner() { return x + a; }
+  return inner;
+}
+while (a < 3) a = a + 1;
+class C < A { m() { return super.m(); } }
+print add(2)();`
+
+	var out strings.Builder
+	Disassemble(&out, compile(t, source))
+
+	expected := `== <script> ==
+0000    1 OP_CONSTANT         0 '1'
+0003    | OP_DEFINE_GLOBAL    1 'a'
+0006    2 OP_CLOSURE          2 <fn add>
+0009    | OP_DEFINE_GLOBAL    3 'add'
+0012    6 OP_GET_GLOBAL       1 'a'
+0015    | OP_CONSTANT         4 '3'
+0018    | OP_LESS
+0019    | OP_JUMP_IF_FALSE   19 -> 37
+0022    | OP_POP
+0023    | OP_GET_GLOBAL       1 'a'
+0026    | OP_CONSTANT         0 '1'
+0029    | OP_ADD
+0030    | OP_SET_GLOBAL       1 'a'
+0033    | OP_POP
+0034    | OP_LOOP            34 -> 12
+0037    | OP_POP
+0038    7 OP_CLASS            5 'C'
+0041    | OP_DEFINE_GLOBAL    5 'C'
+0044    | OP_GET_GLOBAL       6 'A'
+0047    | OP_GET_GLOBAL       5 'C'
+0050    | OP_INHERIT
+0051    | OP_GET_GLOBAL       5 'C'
+0054    | OP_CLOSURE          7 <fn m>
+0057    |                     local 1
+0059    | OP_METHOD           8 'm'
+0062    | OP_POP
+0063    | OP_CLOSE_UPVALUE
+0064    8 OP_GET_GLOBAL       3 'add'
+0067    | OP_CONSTANT         9 '2'
+0070    | OP_CALL             1
+0072    | OP_CALL             0
+0074    | OP_PRINT
+0075    | OP_NIL
+0076    | OP_RETURN
+
+== <fn add> ==
+0000    3 OP_CLOSURE          0 <fn inner>
+0003    |                     local 1
+0005    4 OP_GET_LOCAL        2
+0007    | OP_RETURN
+0008    | OP_NIL
+0009    | OP_RETURN
+
+== <fn inner> ==
+0000    3 OP_GET_UPVALUE      0
+0002    | OP_GET_GLOBAL       0 'a'
+0005    | OP_ADD
+0006    | OP_RETURN
+0007    | OP_NIL
+0008    | OP_RETURN
+
+== <fn m> ==
+0000    7 OP_GET_LOCAL        0
+0002    | OP_GET_UPVALUE      0
+0004    | OP_SUPER_INVOKE  (0 args)    0 'm'
+0008    | OP_RETURN
+0009    | OP_NIL
+0010    | OP_RETURN
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var out, trace strings.Builder
+	machine := New()
+	machine.SetOutput(&out)
+	machine.SetTrace(&trace)
+	if err := machine.Interpret(compile(t, "print -1 + 3;")); err != nil {
+		t.Fatalf("Runtime error: %v", err)
+	}
+
+	expected := `          [ <script> ]
+0000    1 OP_CONSTANT         0 '1'
+          [ <script> ][ 1 ]
+0003    | OP_NEGATE
+          [ <script> ][ -1 ]
+0004    | OP_CONSTANT         1 '3'
+          [ <script> ][ -1 ][ 3 ]
+0007    | OP_ADD
+          [ <script> ][ 2 ]
+0008    | OP_PRINT
+          [ <script> ]
+0009    | OP_NIL
+          [ <script> ][ nil ]
+0010    | OP_RETURN
+`
+	if trace.String() != expected {
+		t.Errorf("Expected trace:\n%s\nGot:\n%s", expected, trace.String())
+	}
+	if out.String() != "2\n" {
+		t.Errorf("Expected output 2, got %q", out.String())
+	}
+}
+
+func TestOpCodeString(t *testing.T) {
+	if OpSuperInvoke.String() != "OP_SUPER_INVOKE" {
+		t.Errorf("Unexpected name %q", OpSuperInvoke.String())
+	}
+	if OpCode(255).String() != "OP_UNKNOWN(255)" {
+		t.Errorf("Unexpected name %q", OpCode(255).String())
+	}
+}
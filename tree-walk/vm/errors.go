@@ -0,0 +1,46 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/interpreter"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+)
+
+// CompileError is a program the compiler cannot represent in bytecode, such
+// as a function with more locals than an instruction can address.
+type CompileError struct {
+	Code    diagnostics.Code
+	Token   scanner.Token
+	Message string
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("[line %d, column %d] Error at '%s': %s", e.Token.Line, e.Token.Column, e.Token.Lexeme, e.Message)
+}
+
+// Diagnostic describes the error as pointing at the offending token.
+func (e *CompileError) Diagnostic() diagnostics.Diagnostic {
+	return diagnostics.Diagnostic{Severity: diagnostics.Error, Code: e.Code, Span: e.Token.Span(), Message: e.Message}
+}
+
+// RuntimeError is an error raised while running bytecode. Bytecode only
+// records source lines, so the error points at a line rather than a token.
+// Stack is the Lox call stack at the point of failure, innermost frame first,
+// ending with the top-level script.
+type RuntimeError struct {
+	Code    diagnostics.Code
+	Line    int
+	Message string
+	Stack   []interpreter.Frame
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("[line %d] Runtime error: %s", e.Line, e.Message)
+}
+
+// Diagnostic describes the error as pointing at the line that failed.
+func (e *RuntimeError) Diagnostic() diagnostics.Diagnostic {
+	return diagnostics.Diagnostic{Severity: diagnostics.Error, Code: e.Code, Span: diagnostics.Span{Line: e.Line}, Message: e.Message}
+}
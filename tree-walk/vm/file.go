@@ -0,0 +1,492 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+// A compiled program is stored in a .loxc file so it can run without being
+// scanned, parsed and compiled again. The file is laid out as:
+//
+//	magic       "LOXC"
+//	version     uint16, little endian
+//	functions   uvarint count, then each function, the script first
+//	checksum    uint32 CRC-32 (IEEE) of every preceding byte, little endian
+//
+// Each function is encoded as:
+//
+//	name        string
+//	arity       byte
+//	upvalues    uvarint
+//	constants   uvarint count, then each constant as a tag byte and a value:
+//	            tagNumber with 8 bytes of float64 bits, tagString with a
+//	            string, or tagFunction with the uvarint index of a function
+//	code        uvarint length, then the bytecode
+//	lines       uvarint count of runs, then each run as uvarint line and
+//	            uvarint number of code bytes on that line
+//
+// Strings are a uvarint length followed by UTF-8 bytes. A function constant
+// always refers to a function later in the table, so the table cannot hold
+// cycles.
+const (
+	Magic         = "LOXC"
+	FormatVersion = 1
+)
+
+const (
+	tagNumber byte = iota + 1
+	tagString
+	tagFunction
+)
+
+// Save writes function, which must be a compiled script, in the .loxc
+// format.
+func Save(w io.Writer, function *Function) error {
+	functions := []*Function{function}
+	index := map[*Function]int{function: 0}
+	for i := 0; i < len(functions); i++ {
+		for _, constant := range functions[i].Chunk.Constants {
+			if nested, ok := constant.AsObject().(*Function); ok {
+				if _, seen := index[nested]; !seen {
+					index[nested] = len(functions)
+					functions = append(functions, nested)
+				}
+			}
+		}
+	}
+
+	buf := []byte(Magic)
+	buf = binary.LittleEndian.AppendUint16(buf, FormatVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(functions)))
+	for _, fn := range functions {
+		buf = appendString(buf, fn.Name)
+		buf = append(buf, byte(fn.Arity))
+		buf = binary.AppendUvarint(buf, uint64(fn.UpvalueCount))
+
+		buf = binary.AppendUvarint(buf, uint64(len(fn.Chunk.Constants)))
+		for _, constant := range fn.Chunk.Constants {
+			if constant.IsNumber() {
+				buf = append(buf, tagNumber)
+				buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(constant.AsNumber()))
+				continue
+			}
+			switch c := constant.AsObject().(type) {
+			case string:
+				buf = append(buf, tagString)
+				buf = appendString(buf, c)
+			case *Function:
+				buf = append(buf, tagFunction)
+				buf = binary.AppendUvarint(buf, uint64(index[c]))
+			default:
+				return fmt.Errorf("cannot save constant of type %T", constant.Interface())
+			}
+		}
+
+		buf = binary.AppendUvarint(buf, uint64(len(fn.Chunk.Code)))
+		buf = append(buf, fn.Chunk.Code...)
+		buf = appendLines(buf, fn.Chunk.Lines)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// appendLines run-length encodes a line table.
+func appendLines(buf []byte, lines []int) []byte {
+	var runs []int
+	for i := 0; i < len(lines); {
+		j := i
+		for j < len(lines) && lines[j] == lines[i] {
+			j++
+		}
+		runs = append(runs, lines[i], j-i)
+		i = j
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(runs)/2))
+	for _, n := range runs {
+		buf = binary.AppendUvarint(buf, uint64(n))
+	}
+	return buf
+}
+
+// Load reads a script saved by Save. It checks the header and checksum and
+// verifies the bytecode of every function, including how it uses the stack,
+// so a damaged or hand-crafted file is reported as an error instead of
+// crashing the VM. What verification cannot rule out is reported by
+// Interpret as a runtime error.
+func Load(r io.Reader) (*Function, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(Magic)+2+4 || string(data[:len(Magic)]) != Magic {
+		return nil, &FileError{Message: "not a compiled Lox file"}
+	}
+	if version := binary.LittleEndian.Uint16(data[len(Magic):]); version != FormatVersion {
+		return nil, &FileError{Message: fmt.Sprintf("unsupported version %d, expected %d", version, FormatVersion)}
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, &FileError{Message: "checksum mismatch"}
+	}
+
+	d := &decoder{data: body, pos: len(Magic) + 2}
+	functions := d.functions()
+	if d.err == nil && d.pos != len(body) {
+		d.fail("unexpected data after the last function")
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if script := functions[0]; script.Arity != 0 || script.UpvalueCount != 0 {
+		return nil, &FileError{Message: "the script takes arguments or captures upvalues"}
+	}
+	for i, fn := range functions {
+		err := verify(fn)
+		if err == nil {
+			err = verifyStack(fn)
+		}
+		if err != nil {
+			return nil, &FileError{Message: fmt.Sprintf("function %d (%s): %v", i, fn, err)}
+		}
+	}
+	return functions[0], nil
+}
+
+// FileError reports a .loxc file that cannot be loaded.
+type FileError struct {
+	Message string
+}
+
+func (e *FileError) Error() string {
+	return "invalid compiled file: " + e.Message
+}
+
+// decoder reads the function table, keeping the first error so callers can
+// check once at the end.
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = &FileError{Message: fmt.Sprintf(format, args...)}
+	}
+}
+
+func (d *decoder) functions() []*Function {
+	count := d.length()
+	if d.err == nil && count == 0 {
+		d.fail("no functions")
+	}
+	if d.err != nil {
+		return nil
+	}
+
+	functions := make([]*Function, count)
+	for i := range functions {
+		functions[i] = &Function{}
+	}
+	for i, fn := range functions {
+		fn.Name = d.string()
+		fn.Arity = int(d.byte())
+		fn.UpvalueCount = d.length()
+
+		constants := d.length()
+		for j := 0; j < constants && d.err == nil; j++ {
+			switch tag := d.byte(); tag {
+			case tagNumber:
+				fn.Chunk.Constants = append(fn.Chunk.Constants, value.Number(math.Float64frombits(binary.LittleEndian.Uint64(d.bytes(8)))))
+			case tagString:
+				fn.Chunk.Constants = append(fn.Chunk.Constants, value.String(d.string()))
+			case tagFunction:
+				index := d.length()
+				if d.err == nil && (index <= i || index >= len(functions)) {
+					d.fail("function %d refers to function %d", i, index)
+				}
+				if d.err == nil {
+					fn.Chunk.Constants = append(fn.Chunk.Constants, value.Object(functions[index]))
+				}
+			default:
+				d.fail("unknown constant tag %d", tag)
+			}
+		}
+
+		fn.Chunk.Code = d.bytes(d.length())
+		runs := d.length()
+		for j := 0; j < runs && d.err == nil; j++ {
+			line, n := d.length(), d.length()
+			if len(fn.Chunk.Lines)+n > len(fn.Chunk.Code) {
+				d.fail("line table of function %d is longer than its code", i)
+			}
+			for k := 0; k < n && d.err == nil; k++ {
+				fn.Chunk.Lines = append(fn.Chunk.Lines, line)
+			}
+		}
+		if d.err == nil && len(fn.Chunk.Lines) != len(fn.Chunk.Code) {
+			d.fail("line table of function %d is shorter than its code", i)
+		}
+		if d.err != nil {
+			return nil
+		}
+	}
+	return functions
+}
+
+func (d *decoder) byte() byte {
+	b := d.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data)-d.pos {
+		d.fail("unexpected end of file")
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+// length reads a uvarint that counts something stored in the file, which
+// can never exceed the size of the file.
+func (d *decoder) length() int {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(d.data[d.pos:])
+	if size <= 0 || n > uint64(len(d.data)) {
+		d.fail("invalid length at offset %d", d.pos)
+		return 0
+	}
+	d.pos += size
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(d.length()))
+}
+
+// verify checks that every instruction of a loaded function is complete,
+// that its constant operands and upvalue references are in range and that
+// jumps land on an instruction.
+func verify(fn *Function) error {
+	chunk := &fn.Chunk
+	code := chunk.Code
+	if len(code) == 0 || OpCode(code[len(code)-1]) != OpReturn {
+		return fmt.Errorf("code does not end with %s", OpReturn)
+	}
+
+	constant := func(offset int, want string) error {
+		index := chunk.short(offset)
+		if index >= len(chunk.Constants) {
+			return fmt.Errorf("constant %d out of range at offset %d", index, offset)
+		}
+		var ok bool
+		switch want {
+		case "string":
+			_, ok = chunk.Constants[index].AsString()
+		case "function":
+			_, ok = chunk.Constants[index].AsObject().(*Function)
+		default:
+			ok = true
+		}
+		if !ok {
+			return fmt.Errorf("constant %d at offset %d is not a %s", index, offset, want)
+		}
+		return nil
+	}
+
+	starts := make([]bool, len(code))
+	var targets []int
+	for offset := 0; offset < len(code); {
+		starts[offset] = true
+		op := OpCode(code[offset])
+		size, ok := operandSize(op)
+		if !ok {
+			return fmt.Errorf("unknown opcode %d at offset %d", code[offset], offset)
+		}
+		if op == OpClosure && offset+3 <= len(code) {
+			if err := constant(offset+1, "function"); err != nil {
+				return err
+			}
+			size += 2 * chunk.Constants[chunk.short(offset+1)].AsObject().(*Function).UpvalueCount
+		}
+		if offset+1+size > len(code) {
+			return fmt.Errorf("truncated %s at offset %d", op, offset)
+		}
+
+		var err error
+		switch op {
+		case OpConstant:
+			err = constant(offset+1, "value")
+		case OpGetGlobal, OpDefineGlobal, OpSetGlobal, OpGetProperty, OpSetProperty, OpGetSuper, OpClass, OpMethod, OpInvoke, OpSuperInvoke:
+			err = constant(offset+1, "string")
+		case OpGetUpvalue, OpSetUpvalue:
+			if int(code[offset+1]) >= fn.UpvalueCount {
+				err = fmt.Errorf("upvalue %d out of range at offset %d", code[offset+1], offset)
+			}
+		case OpJump, OpJumpIfFalse:
+			targets = append(targets, offset, offset+3+chunk.short(offset+1))
+		case OpLoop:
+			targets = append(targets, offset, offset+3-chunk.short(offset+1))
+		case OpClosure:
+			for i := offset + 3; i < offset+1+size; i += 2 {
+				if code[i] > 1 || code[i] == 0 && int(code[i+1]) >= fn.UpvalueCount {
+					err = fmt.Errorf("invalid upvalue capture at offset %d", i)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		offset += 1 + size
+	}
+
+	for i := 0; i < len(targets); i += 2 {
+		if target := targets[i+1]; target < 0 || target >= len(code) || !starts[target] {
+			return fmt.Errorf("jump at offset %d does not land on an instruction", targets[i])
+		}
+	}
+	return nil
+}
+
+// verifyStack follows every path through the code of a function that
+// passed verify, tracking the height of its stack frame. It checks that no
+// instruction pops more values than the frame holds, that local slots are in
+// the frame, that no path runs past the end of the code and that paths
+// meeting at an instruction agree on the height there.
+func verifyStack(fn *Function) error {
+	chunk := &fn.Chunk
+	code := chunk.Code
+	heights := make([]int, len(code))
+	for i := range heights {
+		heights[i] = -1
+	}
+
+	// The frame starts with the callee and its arguments.
+	heights[0] = fn.Arity + 1
+	work := []int{0}
+	reach := func(from, offset, height int) error {
+		switch {
+		case offset >= len(code):
+			return fmt.Errorf("%s at offset %d runs past the end of the code", OpCode(code[from]), from)
+		case heights[offset] == -1:
+			heights[offset] = height
+			work = append(work, offset)
+		case heights[offset] != height:
+			return fmt.Errorf("stack height %d at offset %d, expected %d", height, offset, heights[offset])
+		}
+		return nil
+	}
+
+	for len(work) > 0 {
+		offset := work[len(work)-1]
+		work = work[:len(work)-1]
+		height := heights[offset]
+
+		op := OpCode(code[offset])
+		size, _ := operandSize(op)
+		if op == OpClosure {
+			size += 2 * chunk.Constants[chunk.short(offset+1)].AsObject().(*Function).UpvalueCount
+		}
+		pops, pushes := stackEffect(code, offset)
+		if height < pops {
+			return fmt.Errorf("stack underflow in %s at offset %d", op, offset)
+		}
+
+		switch op {
+		case OpGetLocal, OpSetLocal:
+			if slot := int(code[offset+1]); slot >= height {
+				return fmt.Errorf("local slot %d out of range at offset %d", slot, offset)
+			}
+		case OpClosure:
+			for i := offset + 3; i < offset+1+size; i += 2 {
+				// A local function captures the slot the closure is pushed to.
+				if code[i] == 1 && int(code[i+1]) > height {
+					return fmt.Errorf("captured local slot %d out of range at offset %d", code[i+1], offset)
+				}
+			}
+		}
+		height += pushes - pops
+
+		var err error
+		switch op {
+		case OpReturn:
+		case OpJump:
+			err = reach(offset, offset+3+chunk.short(offset+1), height)
+		case OpLoop:
+			err = reach(offset, offset+3-chunk.short(offset+1), height)
+		case OpJumpIfFalse:
+			err = reach(offset, offset+3+chunk.short(offset+1), height)
+			if err == nil {
+				err = reach(offset, offset+3, height)
+			}
+		default:
+			err = reach(offset, offset+1+size, height)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stackEffect returns how many values the instruction at offset pops from
+// the stack and how many it then pushes.
+func stackEffect(code []byte, offset int) (pops, pushes int) {
+	switch op := OpCode(code[offset]); op {
+	case OpConstant, OpNil, OpTrue, OpFalse, OpGetLocal, OpGetGlobal, OpGetUpvalue, OpClosure, OpClass:
+		return 0, 1
+	case OpPop, OpDefineGlobal, OpPrint, OpCloseUpvalue, OpReturn:
+		return 1, 0
+	case OpSetLocal, OpSetGlobal, OpSetUpvalue, OpGetProperty, OpNot, OpNegate, OpJumpIfFalse:
+		return 1, 1
+	case OpCall:
+		return int(code[offset+1]) + 1, 1
+	case OpInvoke:
+		return int(code[offset+3]) + 1, 1
+	case OpSuperInvoke:
+		return int(code[offset+3]) + 2, 1
+	case OpJump, OpLoop:
+		return 0, 0
+	default:
+		// OpSetProperty, OpGetSuper, the binary operators, OpInherit and
+		// OpMethod.
+		return 2, 1
+	}
+}
+
+// operandSize returns the number of operand bytes that follow op, not
+// counting the upvalue pairs of OpClosure, and whether op is known.
+func operandSize(op OpCode) (int, bool) {
+	switch op {
+	case OpGetLocal, OpSetLocal, OpGetUpvalue, OpSetUpvalue, OpCall:
+		return 1, true
+	case OpConstant, OpGetGlobal, OpDefineGlobal, OpSetGlobal, OpGetProperty, OpSetProperty, OpGetSuper,
+		OpJump, OpJumpIfFalse, OpLoop, OpClosure, OpClass, OpMethod:
+		return 2, true
+	case OpInvoke, OpSuperInvoke:
+		return 3, true
+	}
+	return 0, op <= OpMethod
+}
@@ -0,0 +1,189 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+func TestSaveLoad_RoundTrip(t *testing.T) {
+	for _, tt := range programs {
+		t.Run(tt.name, func(t *testing.T) {
+			function := compile(t, tt.source)
+
+			var buf bytes.Buffer
+			if err := Save(&buf, function); err != nil {
+				t.Fatalf("Save error: %v", err)
+			}
+			loaded, err := Load(&buf)
+			if err != nil {
+				t.Fatalf("Load error: %v", err)
+			}
+			if !reflect.DeepEqual(function, loaded) {
+				t.Fatalf("Loaded function differs from the saved one")
+			}
+
+			var want, got strings.Builder
+			for _, run := range []struct {
+				fn  *Function
+				out *strings.Builder
+			}{{function, &want}, {loaded, &got}} {
+				machine := New()
+				machine.SetOutput(run.out)
+				if err := machine.Interpret(run.fn); err != nil {
+					t.Fatalf("Runtime error: %v", err)
+				}
+			}
+			if got.String() != want.String() {
+				t.Errorf("Expected output:\n%s\nGot:\n%s", want.String(), got.String())
+			}
+		})
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Save(&buf, compile(t, "fun f(a) { return a; }\nprint f(1);")); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	valid := buf.Bytes()
+
+	// sign appends the checksum to a file body edited by a test.
+	sign := func(body []byte) []byte {
+		return binary.LittleEndian.AppendUint32(append([]byte{}, body...), crc32.ChecksumIEEE(body))
+	}
+	body := valid[:len(valid)-4]
+
+	badJump := compile(t, "if (true) print 1;")
+	badJump.Chunk.Code[2] = 2 // jump into the middle of an instruction
+	var badJumpFile bytes.Buffer
+	Save(&badJumpFile, badJump)
+
+	badOp := compile(t, "print 1;")
+	badOp.Chunk.Code[3] = 200
+	var badOpFile bytes.Buffer
+	Save(&badOpFile, badOp)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"local slot", craft(t, OpGetLocal, 200, OpPrint, OpNil, OpReturn), "local slot 200 out of range at offset 0"},
+		{"underflow", craft(t, OpPop, OpPop, OpNil, OpReturn), "stack underflow in OP_POP at offset 1"},
+		{"call underflow", craft(t, OpNil, OpCall, 3, OpReturn), "stack underflow in OP_CALL at offset 1"},
+		{"unbalanced branches", craft(t, OpTrue, OpJumpIfFalse, 0, 1, OpNil, OpNil, OpReturn), "stack height 3 at offset 5, expected 2"},
+		{"empty", nil, "not a compiled Lox file"},
+		{"magic", append([]byte("LOXX"), valid[4:]...), "not a compiled Lox file"},
+		{"version", append(append([]byte(Magic), 9, 0), valid[6:]...), "unsupported version 9, expected 1"},
+		{"checksum", append(append([]byte{}, valid[:len(valid)-1]...), valid[len(valid)-1]^1), "checksum mismatch"},
+		{"truncated", sign(body[:len(body)-5]), "unexpected end of file"},
+		{"trailing data", sign(append(append([]byte{}, body...), 0)), "unexpected data after the last function"},
+		{"jump", badJumpFile.Bytes(), "does not land on an instruction"},
+		{"opcode", badOpFile.Bytes(), "unknown opcode 200 at offset 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(bytes.NewReader(tt.data))
+			var fileErr *FileError
+			if !errors.As(err, &fileErr) {
+				t.Fatalf("Expected a *FileError, got %T: %v", err, err)
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected an error containing %q, got %q", tt.expected, err.Error())
+			}
+		})
+	}
+}
+
+// craft saves a script with the given code, one byte per line, and a
+// constant "m", as a .loxc file that is well formed but whose code may be
+// unsound.
+func craft(t *testing.T, code ...interface{}) []byte {
+	t.Helper()
+	fn := &Function{}
+	fn.Chunk.Constants = append(fn.Chunk.Constants, value.String("m"))
+	for _, b := range code {
+		switch b := b.(type) {
+		case OpCode:
+			fn.Chunk.write(byte(b), 1)
+		case int:
+			fn.Chunk.write(byte(b), 1)
+		}
+	}
+	var buf bytes.Buffer
+	if err := Save(&buf, fn); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestLoad_InvalidBytecodeIsARuntimeError runs loaded files that pass
+// verification but misuse their operands.
+func TestLoad_InvalidBytecodeIsARuntimeError(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		// OP_METHOD on nil instead of a class and a closure.
+		{"type", craft(t, OpNil, OpNil, OpMethod, 0, 0, OpNil, OpReturn), "interface conversion"},
+		{"upvalue", escapedUpvalue(t), "index out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			function, err := Load(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("Load error: %v", err)
+			}
+			err = New().Interpret(function)
+			var runtimeErr *RuntimeError
+			if !errors.As(err, &runtimeErr) {
+				t.Fatalf("Expected a *RuntimeError, got %T: %v", err, err)
+			}
+			if runtimeErr.Code != diagnostics.InvalidBytecode || !strings.Contains(runtimeErr.Message, tt.expected) {
+				t.Errorf("Expected an %s error containing %q, got %s: %s", diagnostics.InvalidBytecode, tt.expected, runtimeErr.Code, runtimeErr.Message)
+			}
+		})
+	}
+}
+
+// escapedUpvalue returns a .loxc file whose script stores a closure over a
+// local slot in a global, pops the slot and then calls the closure, which
+// reads past the end of the stack.
+func escapedUpvalue(t *testing.T) []byte {
+	t.Helper()
+	inner := &Function{Name: "f", UpvalueCount: 1}
+	for _, b := range []OpCode{OpGetUpvalue, 0, OpReturn} {
+		inner.Chunk.write(byte(b), 1)
+	}
+	script := &Function{}
+	script.Chunk.Constants = []value.Value{value.String("m"), value.Object(inner)}
+	for _, b := range []OpCode{
+		OpNil,
+		OpClosure, 0, 1, 1, 2,
+		OpDefineGlobal, 0, 0,
+		OpPop,
+		OpGetGlobal, 0, 0,
+		OpCall, 0,
+		OpPop,
+		OpNil,
+		OpReturn,
+	} {
+		script.Chunk.write(byte(b), 1)
+	}
+	var buf bytes.Buffer
+	if err := Save(&buf, script); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,80 @@
+package vm
+
+import "github.com/acautin/lox-implementation-exercise/tree-walk/value"
+
+// Function is a compiled function. The top-level script is a function with
+// an empty name.
+type Function struct {
+	Name         string
+	Arity        int
+	UpvalueCount int
+	Chunk        Chunk
+}
+
+func (f *Function) String() string {
+	if f.Name == "" {
+		return "<script>"
+	}
+	return "<fn " + f.Name + ">"
+}
+
+// Closure is a function together with the variables it captured.
+type Closure struct {
+	Function *Function
+	Upvalues []*Upvalue
+}
+
+func (c *Closure) String() string {
+	return c.Function.String()
+}
+
+// Upvalue is a variable captured by a closure. While the variable is still
+// on the stack the upvalue refers to its slot; once the variable goes out of
+// scope the upvalue is closed and holds the value itself.
+type Upvalue struct {
+	slot   int
+	closed value.Value
+	open   bool
+	next   *Upvalue // next open upvalue, in decreasing slot order
+}
+
+// Class is a class with its methods, including inherited ones.
+type Class struct {
+	Name    string
+	Methods map[string]*Closure
+}
+
+func (c *Class) String() string {
+	return c.Name
+}
+
+// Instance is an object created by calling a class.
+type Instance struct {
+	Class  *Class
+	Fields map[string]value.Value
+}
+
+func (i *Instance) String() string {
+	return i.Class.Name + " instance"
+}
+
+// BoundMethod is a method bound to the instance it was accessed on.
+type BoundMethod struct {
+	Receiver value.Value
+	Method   *Closure
+}
+
+func (b *BoundMethod) String() string {
+	return b.Method.String()
+}
+
+// Native is a function implemented in Go.
+type Native struct {
+	Name  string
+	Arity int
+	Fn    func(arguments []value.Value) (value.Value, error)
+}
+
+func (n *Native) String() string {
+	return "<native fn>"
+}
@@ -0,0 +1,487 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/interpreter"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/value"
+)
+
+// framesMax bounds the depth of Lox calls, so runaway recursion is reported
+// as a runtime error instead of exhausting memory.
+const framesMax = 4096
+
+// callFrame is an active call of a closure. Its locals start at base on the
+// value stack, where slot zero holds the callee or the receiver.
+type callFrame struct {
+	closure *Closure
+	ip      int
+	base    int
+	name    string // name used in stack traces, empty for the script
+}
+
+// VM executes compiled functions on a value stack. Globals persist across
+// calls to Interpret.
+type VM struct {
+	out          io.Writer
+	stack        []value.Value
+	frames       []callFrame
+	globals      map[string]value.Value
+	openUpvalues *Upvalue
+	trace        io.Writer
+}
+
+// New creates a VM that prints to standard output.
+func New() *VM {
+	vm := &VM{
+		out:     os.Stdout,
+		globals: make(map[string]value.Value),
+	}
+	vm.defineNative("clock", 0, func(arguments []value.Value) (value.Value, error) {
+		return value.Number(float64(time.Now().UnixNano()) / 1e9), nil
+	})
+	return vm
+}
+
+// SetOutput changes the writer used by print statements.
+func (vm *VM) SetOutput(out io.Writer) {
+	vm.out = out
+}
+
+// SetTrace makes the VM write the value stack and the instruction to trace
+// before executing each instruction. A nil writer turns tracing off.
+func (vm *VM) SetTrace(trace io.Writer) {
+	vm.trace = trace
+}
+
+func (vm *VM) defineNative(name string, arity int, fn func(arguments []value.Value) (value.Value, error)) {
+	vm.globals[name] = value.Object(&Native{Name: name, Arity: arity, Fn: fn})
+}
+
+// Interpret runs the top-level function of a compiled script, stopping at
+// the first runtime error.
+func (vm *VM) Interpret(function *Function) (err error) {
+	// The compiler never produces code that fails here, and Load rejects
+	// files whose stack use is unsound, but it cannot prove everything about
+	// a hand-crafted file: an upvalue can outlive the slot it refers to, or an
+	// operand can have the wrong type. Such code is reported instead of
+	// crashing.
+	defer func() {
+		if r := recover(); r != nil {
+			failure, ok := r.(runtime.Error)
+			if !ok {
+				panic(r)
+			}
+			err = vm.runtimeError(diagnostics.InvalidBytecode, "Invalid bytecode: %s.", strings.TrimPrefix(failure.Error(), "runtime error: "))
+		}
+	}()
+
+	vm.stack = vm.stack[:0]
+	vm.frames = vm.frames[:0]
+	vm.openUpvalues = nil
+
+	closure := &Closure{Function: function}
+	vm.push(value.Object(closure))
+	vm.frames = append(vm.frames, callFrame{closure: closure})
+	return vm.run()
+}
+
+func (vm *VM) push(v value.Value) {
+	vm.stack = append(vm.stack, v)
+}
+
+func (vm *VM) pop() value.Value {
+	v := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return v
+}
+
+func (vm *VM) peek(distance int) value.Value {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+// runtimeError creates an error at the instruction being executed, with the
+// stack trace of every active frame.
+func (vm *VM) runtimeError(code diagnostics.Code, format string, args ...interface{}) error {
+	stack := make([]interpreter.Frame, 0, len(vm.frames))
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		frame := &vm.frames[i]
+		line := 0
+		if frame.ip > 0 {
+			line = frame.closure.Function.Chunk.Lines[frame.ip-1]
+		}
+		stack = append(stack, interpreter.Frame{Function: frame.name, Line: line, TopLevel: i == 0})
+	}
+	return &RuntimeError{Code: code, Line: stack[0].Line, Message: fmt.Sprintf(format, args...), Stack: stack}
+}
+
+func (vm *VM) run() error {
+	frame := &vm.frames[len(vm.frames)-1]
+	code := frame.closure.Function.Chunk.Code
+	constants := frame.closure.Function.Chunk.Constants
+
+	readByte := func() byte {
+		frame.ip++
+		return code[frame.ip-1]
+	}
+	readShort := func() int {
+		frame.ip += 2
+		return int(code[frame.ip-2])<<8 | int(code[frame.ip-1])
+	}
+	readString := func() string {
+		s, _ := constants[readShort()].AsString()
+		return s
+	}
+	// enter switches execution to the innermost frame after a call or return.
+	enter := func() {
+		frame = &vm.frames[len(vm.frames)-1]
+		code = frame.closure.Function.Chunk.Code
+		constants = frame.closure.Function.Chunk.Constants
+	}
+
+	for {
+		if vm.trace != nil {
+			fmt.Fprintln(vm.trace, traceStack(vm.stack))
+			DisassembleInstruction(vm.trace, &frame.closure.Function.Chunk, frame.ip)
+		}
+
+		switch OpCode(readByte()) {
+		case OpConstant:
+			vm.push(constants[readShort()])
+		case OpNil:
+			vm.push(value.Nil)
+		case OpTrue:
+			vm.push(value.Bool(true))
+		case OpFalse:
+			vm.push(value.Bool(false))
+		case OpPop:
+			vm.pop()
+
+		case OpGetLocal:
+			vm.push(vm.stack[frame.base+int(readByte())])
+		case OpSetLocal:
+			vm.stack[frame.base+int(readByte())] = vm.peek(0)
+		case OpGetGlobal:
+			name := readString()
+			global, ok := vm.globals[name]
+			if !ok {
+				return vm.runtimeError(diagnostics.UndefinedVariable, "Undefined variable '%s'.", name)
+			}
+			vm.push(global)
+		case OpDefineGlobal:
+			vm.globals[readString()] = vm.pop()
+		case OpSetGlobal:
+			name := readString()
+			if _, ok := vm.globals[name]; !ok {
+				return vm.runtimeError(diagnostics.UndefinedVariable, "Undefined variable '%s'.", name)
+			}
+			vm.globals[name] = vm.peek(0)
+		case OpGetUpvalue:
+			vm.push(vm.upvalueGet(frame.closure.Upvalues[readByte()]))
+		case OpSetUpvalue:
+			vm.upvalueSet(frame.closure.Upvalues[readByte()], vm.peek(0))
+
+		case OpGetProperty:
+			name := readString()
+			instance, ok := vm.peek(0).AsObject().(*Instance)
+			if !ok {
+				return vm.runtimeError(diagnostics.NotAnInstance, "Only instances have properties.")
+			}
+			if field, ok := instance.Fields[name]; ok {
+				vm.stack[len(vm.stack)-1] = field
+				break
+			}
+			if err := vm.bindMethod(instance.Class, name); err != nil {
+				return err
+			}
+		case OpSetProperty:
+			name := readString()
+			instance, ok := vm.peek(1).AsObject().(*Instance)
+			if !ok {
+				return vm.runtimeError(diagnostics.NotAnInstance, "Only instances have fields.")
+			}
+			instance.Fields[name] = vm.peek(0)
+			field := vm.pop()
+			vm.stack[len(vm.stack)-1] = field
+		case OpGetSuper:
+			name := readString()
+			superclass := vm.pop().AsObject().(*Class)
+			if err := vm.bindMethod(superclass, name); err != nil {
+				return err
+			}
+
+		case OpEqual:
+			b, a := vm.pop(), vm.pop()
+			vm.push(value.Bool(a.Equal(b)))
+		case OpGreater, OpGreaterEqual, OpLess, OpLessEqual, OpSubtract, OpMultiply, OpDivide:
+			op := OpCode(code[frame.ip-1])
+			b, a := vm.peek(0), vm.peek(1)
+			if !a.IsNumber() || !b.IsNumber() {
+				return vm.runtimeError(diagnostics.OperandType, "Operands must be numbers.")
+			}
+			if op == OpDivide && b.AsNumber() == 0 {
+				return vm.runtimeError(diagnostics.DivisionByZero, "Division by zero.")
+			}
+			vm.stack = vm.stack[:len(vm.stack)-1]
+			vm.stack[len(vm.stack)-1] = arithmetic(op, a.AsNumber(), b.AsNumber())
+		case OpAdd:
+			b, a := vm.peek(0), vm.peek(1)
+			if a.IsNumber() && b.IsNumber() {
+				vm.stack = vm.stack[:len(vm.stack)-1]
+				vm.stack[len(vm.stack)-1] = value.Number(a.AsNumber() + b.AsNumber())
+				break
+			}
+			if aStr, ok := a.AsString(); ok {
+				if bStr, ok := b.AsString(); ok {
+					vm.stack = vm.stack[:len(vm.stack)-1]
+					vm.stack[len(vm.stack)-1] = value.String(aStr + bStr)
+					break
+				}
+			}
+			return vm.runtimeError(diagnostics.OperandType, "Operands must be two numbers or two strings.")
+		case OpNot:
+			vm.stack[len(vm.stack)-1] = value.Bool(!vm.peek(0).Truthy())
+		case OpNegate:
+			if !vm.peek(0).IsNumber() {
+				return vm.runtimeError(diagnostics.OperandType, "Operand must be a number.")
+			}
+			vm.stack[len(vm.stack)-1] = value.Number(-vm.peek(0).AsNumber())
+		case OpPrint:
+			fmt.Fprintln(vm.out, interpreter.Stringify(vm.pop()))
+
+		case OpJump:
+			offset := readShort()
+			frame.ip += offset
+		case OpJumpIfFalse:
+			offset := readShort()
+			if !vm.peek(0).Truthy() {
+				frame.ip += offset
+			}
+		case OpLoop:
+			offset := readShort()
+			frame.ip -= offset
+
+		case OpCall:
+			argCount := int(readByte())
+			if err := vm.callValue(vm.peek(argCount), argCount); err != nil {
+				return err
+			}
+			enter()
+		case OpInvoke:
+			name := readString()
+			argCount := int(readByte())
+			if err := vm.invoke(name, argCount); err != nil {
+				return err
+			}
+			enter()
+		case OpSuperInvoke:
+			name := readString()
+			argCount := int(readByte())
+			superclass := vm.pop().AsObject().(*Class)
+			if err := vm.invokeFromClass(superclass, name, argCount); err != nil {
+				return err
+			}
+			enter()
+		case OpClosure:
+			function := constants[readShort()].AsObject().(*Function)
+			closure := &Closure{Function: function, Upvalues: make([]*Upvalue, function.UpvalueCount)}
+			for i := range closure.Upvalues {
+				isLocal := readByte()
+				index := int(readByte())
+				if isLocal == 1 {
+					closure.Upvalues[i] = vm.captureUpvalue(frame.base + index)
+				} else {
+					closure.Upvalues[i] = frame.closure.Upvalues[index]
+				}
+			}
+			vm.push(value.Object(closure))
+		case OpCloseUpvalue:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.pop()
+		case OpReturn:
+			result := vm.pop()
+			vm.closeUpvalues(frame.base)
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == 0 {
+				vm.pop()
+				return nil
+			}
+			vm.stack = vm.stack[:frame.base]
+			vm.push(result)
+			enter()
+
+		case OpClass:
+			name := readString()
+			vm.push(value.Object(&Class{Name: name, Methods: make(map[string]*Closure)}))
+		case OpInherit:
+			superclass, ok := vm.peek(1).AsObject().(*Class)
+			if !ok {
+				return vm.runtimeError(diagnostics.SuperclassNotClass, "Superclass must be a class.")
+			}
+			subclass := vm.peek(0).AsObject().(*Class)
+			for name, method := range superclass.Methods {
+				subclass.Methods[name] = method
+			}
+			vm.pop()
+		case OpMethod:
+			name := readString()
+			class := vm.peek(1).AsObject().(*Class)
+			class.Methods[name] = vm.pop().AsObject().(*Closure)
+
+		default:
+			panic(fmt.Sprintf("vm: unknown opcode %d", code[frame.ip-1]))
+		}
+	}
+}
+
+func arithmetic(op OpCode, a, b float64) value.Value {
+	switch op {
+	case OpGreater:
+		return value.Bool(a > b)
+	case OpGreaterEqual:
+		return value.Bool(a >= b)
+	case OpLess:
+		return value.Bool(a < b)
+	case OpLessEqual:
+		return value.Bool(a <= b)
+	case OpSubtract:
+		return value.Number(a - b)
+	case OpMultiply:
+		return value.Number(a * b)
+	default:
+		return value.Number(a / b)
+	}
+}
+
+// Calls
+
+func (vm *VM) callValue(callee value.Value, argCount int) error {
+	switch callee := callee.AsObject().(type) {
+	case *Closure:
+		return vm.call(callee, argCount, callee.Function.Name)
+	case *BoundMethod:
+		vm.stack[len(vm.stack)-argCount-1] = callee.Receiver
+		return vm.call(callee.Method, argCount, callee.Method.Function.Name)
+	case *Class:
+		vm.stack[len(vm.stack)-argCount-1] = value.Object(&Instance{Class: callee, Fields: make(map[string]value.Value)})
+		if initializer, ok := callee.Methods["init"]; ok {
+			return vm.call(initializer, argCount, callee.Name)
+		}
+		if argCount != 0 {
+			return vm.runtimeError(diagnostics.ArityMismatch, "Expected 0 arguments but got %d.", argCount)
+		}
+		return nil
+	case *Native:
+		if argCount != callee.Arity {
+			return vm.runtimeError(diagnostics.ArityMismatch, "Expected %d arguments but got %d.", callee.Arity, argCount)
+		}
+		result, err := callee.Fn(vm.stack[len(vm.stack)-argCount:])
+		if err != nil {
+			return err
+		}
+		vm.stack = vm.stack[:len(vm.stack)-argCount-1]
+		vm.push(result)
+		return nil
+	}
+	return vm.runtimeError(diagnostics.NotCallable, "Can only call functions and classes.")
+}
+
+func (vm *VM) call(closure *Closure, argCount int, name string) error {
+	if argCount != closure.Function.Arity {
+		return vm.runtimeError(diagnostics.ArityMismatch, "Expected %d arguments but got %d.", closure.Function.Arity, argCount)
+	}
+	if len(vm.frames) == framesMax {
+		return vm.runtimeError(diagnostics.StackOverflow, "Stack overflow.")
+	}
+	vm.frames = append(vm.frames, callFrame{closure: closure, base: len(vm.stack) - argCount - 1, name: name})
+	return nil
+}
+
+// invoke calls a method on the receiver below the arguments without
+// creating a bound method. A field holding a function is called instead.
+func (vm *VM) invoke(name string, argCount int) error {
+	instance, ok := vm.peek(argCount).AsObject().(*Instance)
+	if !ok {
+		return vm.runtimeError(diagnostics.NotAnInstance, "Only instances have properties.")
+	}
+	if field, ok := instance.Fields[name]; ok {
+		vm.stack[len(vm.stack)-argCount-1] = field
+		return vm.callValue(field, argCount)
+	}
+	return vm.invokeFromClass(instance.Class, name, argCount)
+}
+
+func (vm *VM) invokeFromClass(class *Class, name string, argCount int) error {
+	method, ok := class.Methods[name]
+	if !ok {
+		return vm.runtimeError(diagnostics.UndefinedProperty, "Undefined property '%s'.", name)
+	}
+	return vm.call(method, argCount, method.Function.Name)
+}
+
+// bindMethod replaces the instance on top of the stack with its method
+// called name, bound to it.
+func (vm *VM) bindMethod(class *Class, name string) error {
+	method, ok := class.Methods[name]
+	if !ok {
+		return vm.runtimeError(diagnostics.UndefinedProperty, "Undefined property '%s'.", name)
+	}
+	bound := &BoundMethod{Receiver: vm.peek(0), Method: method}
+	vm.stack[len(vm.stack)-1] = value.Object(bound)
+	return nil
+}
+
+// Upvalues
+
+func (vm *VM) upvalueGet(upvalue *Upvalue) value.Value {
+	if upvalue.open {
+		return vm.stack[upvalue.slot]
+	}
+	return upvalue.closed
+}
+
+func (vm *VM) upvalueSet(upvalue *Upvalue, v value.Value) {
+	if upvalue.open {
+		vm.stack[upvalue.slot] = v
+		return
+	}
+	upvalue.closed = v
+}
+
+// captureUpvalue returns the open upvalue for a stack slot, creating it if
+// no closure has captured the slot yet.
+func (vm *VM) captureUpvalue(slot int) *Upvalue {
+	var prev *Upvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.slot > slot {
+		prev, upvalue = upvalue, upvalue.next
+	}
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+
+	created := &Upvalue{slot: slot, open: true, next: upvalue}
+	if prev == nil {
+		vm.openUpvalues = created
+	} else {
+		prev.next = created
+	}
+	return created
+}
+
+// closeUpvalues moves every captured variable at or above slot off the
+// stack and into its upvalue.
+func (vm *VM) closeUpvalues(slot int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= slot {
+		upvalue := vm.openUpvalues
+		upvalue.closed = vm.stack[upvalue.slot]
+		upvalue.open = false
+		vm.openUpvalues = upvalue.next
+	}
+}
@@ -0,0 +1,427 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/acautin/lox-implementation-exercise/tree-walk/diagnostics"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/interpreter"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/optimizer"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/parser"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/resolver"
+	"github.com/acautin/lox-implementation-exercise/tree-walk/scanner"
+)
+
+// programs are run by both the VM and the tree-walk interpreter, which must
+// print the same output.
+var programs = []struct {
+	name   string
+	source string
+}{
+	{"arithmetic", "print 1 + 2 * 3; print (1 + 2) * 3; print -4 / 2; print 7 - 10;"},
+	{"comparison", "print 1 < 2; print 2 <= 2; print 3 > 4; print 4 >= 5; print 1 == 1; print 1 != 1;"},
+	{"equality", "print nil == nil; print \"a\" == \"a\"; print 1 == \"1\"; print true != false;"},
+	{"not", "print !nil; print !0; print !\"\"; print !!true;"},
+	{"strings", "var s = \"a\"; s = s + \"b\" + \"c\"; print s;"},
+	{"numbers", "print 0.1 + 0.2; print 1000000 * 1000000 * 1000000 * 1000; print 100; print -0.5;"},
+	{"globals", "var a = 1; var b; print a; print b; a = b = 3; print a + b;"},
+	{"locals", "var a = \"global\"; { var a = \"inner\"; { var b = a + \"!\"; print b; } print a; } print a;"},
+	{"if", "if (1 > 2) print \"yes\"; else print \"no\"; if (nil) print 1; if (true) print 2;"},
+	{"logical", "print \"hi\" or 2; print nil or \"yes\"; print nil and 1; print 1 and 2;"},
+	{"short circuit", "var a = 0; false and (a = 1); true or (a = 2); print a;"},
+	{"while", "var i = 0; while (i < 3) { print i; i = i + 1; }"},
+	{"for", "for (var i = 0; i < 3; i = i + 1) { var j = i * 2; print j; }"},
+	{"functions", "fun add(a, b) { return a + b; } print add(1, 2); fun f() {} print f(); print f; print add;"},
+	{"recursion", "fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); } print fib(15);"},
+	{"local functions", "{ fun even(n) { if (n == 0) return true; return !even(n - 1); } print even(4); }"},
+	{"natives", "print clock; print clock() > 0;"},
+	{"closures", `
+fun counter() {
+  var n = 0;
+  fun inc() { n = n + 1; return n; }
+  return inc;
+}
+var c = counter();
+c(); c();
+print c();
+var d = counter();
+print d();`},
+	{"shared upvalues", `
+var get; var set;
+{
+  var x = "before";
+  fun g() { return x; }
+  fun s(v) { x = v; }
+  get = g; set = s;
+}
+set("after");
+print get();`},
+	{"closed loop variables", `
+var fs = "";
+var first; var second;
+for (var i = 0; i < 2; i = i + 1) {
+  var j = i;
+  fun f() { return j; }
+  if (first == nil) first = f; else second = f;
+}
+print first(); print second();`},
+	{"nested closures", `
+fun outer() {
+  var a = "a";
+  fun middle() {
+    fun inner() { return a + "!"; }
+    return inner;
+  }
+  return middle;
+}
+print outer()()();`},
+	{"classes", `
+class Point {
+  init(x, y) { this.x = x; this.y = y; }
+  sum() { return this.x + this.y; }
+}
+var p = Point(1, 2);
+print p.sum();
+p.x = 10;
+print p.sum();
+print Point;
+print p;
+print p.sum;`},
+	{"bound methods", `
+class A {
+  init(n) { this.n = n; }
+  get() { return this.n; }
+}
+var m = A(3).get;
+print m();`},
+	{"fields holding functions", `
+class Box {}
+fun hello() { return "hello"; }
+var b = Box();
+b.f = hello;
+print b.f();`},
+	{"initializer returns this", `
+class A { init() { this.v = 1; return; } }
+var a = A();
+print a.init();
+print a.init().v;`},
+	{"closures in methods", `
+class Counter {
+  init() { this.n = 0; }
+  incrementer() {
+    fun inc() { this.n = this.n + 1; return this.n; }
+    return inc;
+  }
+}
+var c = Counter();
+var inc = c.incrementer();
+inc();
+print inc();`},
+	{"inheritance", `
+class A {
+  init(name) { this.name = name; }
+  greet() { return "A " + this.name; }
+  who() { return "A"; }
+}
+class B < A {
+  greet() { return "B then " + super.greet(); }
+  who() { var m = super.who; return m() + "B"; }
+}
+var b = B("x");
+print b.greet();
+print b.who();
+print B;`},
+	{"local classes", `
+{
+  class A { f() { return "f"; } }
+  class B < A {}
+  print B().f();
+}`},
+}
+
+func TestVM_MatchesInterpreter(t *testing.T) {
+	for _, tt := range programs {
+		t.Run(tt.name, func(t *testing.T) {
+			statements := parse(t, tt.source)
+
+			var want strings.Builder
+			interp := interpreter.NewInterpreter()
+			interp.SetOutput(&want)
+			if err := resolver.NewResolver(interp).Resolve(statements); err != nil {
+				t.Fatalf("Resolve error: %v", err)
+			}
+			if err := interp.Execute(statements); err != nil {
+				t.Fatalf("Interpreter error: %v", err)
+			}
+
+			got, err := run(t, tt.source)
+			if err != nil {
+				t.Fatalf("VM error: %v", err)
+			}
+			if got != want.String() {
+				t.Errorf("Expected output:\n%s\nGot:\n%s", want.String(), got)
+			}
+		})
+	}
+}
+
+// TestVM_MatchesInterpreterOptimized runs programs whose constants differ
+// only after folding on both engines.
+func TestVM_MatchesInterpreterOptimized(t *testing.T) {
+	for _, source := range []string{
+		"print 0; print -0;",
+		"print -0; print 0; print 0 * -1;",
+	} {
+		outputs := make([]string, 2)
+		for i := range outputs {
+			statements, ranges := parseWithRanges(t, source)
+			interp := interpreter.NewInterpreter()
+			if err := resolver.NewResolver(interp).Resolve(statements); err != nil {
+				t.Fatalf("Resolve error: %v", err)
+			}
+			statements, err := optimizer.NewOptimizer().Optimize(statements)
+			if err != nil {
+				t.Fatalf("Optimize error: %v", err)
+			}
+
+			var out strings.Builder
+			if i == 0 {
+				interp.SetOutput(&out)
+				err = interp.Execute(statements)
+			} else {
+				var function *Function
+				if function, err = Compile(statements, ranges); err == nil {
+					machine := New()
+					machine.SetOutput(&out)
+					err = machine.Interpret(function)
+				}
+			}
+			if err != nil {
+				t.Fatalf("Source: %s\nError: %v", source, err)
+			}
+			outputs[i] = out.String()
+		}
+		if outputs[0] != outputs[1] {
+			t.Errorf("Source: %s\nInterpreter printed:\n%s\nVM printed:\n%s", source, outputs[0], outputs[1])
+		}
+	}
+}
+
+func TestVM_RuntimeErrors(t *testing.T) {
+	tests := []struct {
+		source   string
+		code     diagnostics.Code
+		expected string
+	}{
+		{"print 5 / 0;", diagnostics.DivisionByZero, "[line 1] Runtime error: Division by zero."},
+		{"print true + false;", diagnostics.OperandType, "[line 1] Runtime error: Operands must be two numbers or two strings."},
+		{"print -\"s\";", diagnostics.OperandType, "[line 1] Runtime error: Operand must be a number."},
+		{"print \"a\" < 1;", diagnostics.OperandType, "[line 1] Runtime error: Operands must be numbers."},
+		{"print x;", diagnostics.UndefinedVariable, "[line 1] Runtime error: Undefined variable 'x'."},
+		{"x = 1;", diagnostics.UndefinedVariable, "[line 1] Runtime error: Undefined variable 'x'."},
+		{"\"s\"();", diagnostics.NotCallable, "[line 1] Runtime error: Can only call functions and classes."},
+		{"fun f(a) {}\nf();", diagnostics.ArityMismatch, "[line 2] Runtime error: Expected 1 arguments but got 0."},
+		{"class A {}\nA(1);", diagnostics.ArityMismatch, "[line 2] Runtime error: Expected 0 arguments but got 1."},
+		{"class A {}\nprint A().x;", diagnostics.UndefinedProperty, "[line 2] Runtime error: Undefined property 'x'."},
+		{"class A {}\nA().m();", diagnostics.UndefinedProperty, "[line 2] Runtime error: Undefined property 'm'."},
+		{"print 1 .x;", diagnostics.NotAnInstance, "[line 1] Runtime error: Only instances have properties."},
+		{"var s = \"s\"; s.x = 1;", diagnostics.NotAnInstance, "[line 1] Runtime error: Only instances have fields."},
+		{"var A = 1;\nclass B < A {}", diagnostics.SuperclassNotClass, "[line 2] Runtime error: Superclass must be a class."},
+		{"fun f() { f(); }\nf();", diagnostics.StackOverflow, "[line 1] Runtime error: Stack overflow."},
+	}
+
+	for _, tt := range tests {
+		_, err := run(t, tt.source)
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) {
+			t.Errorf("Source: %s\nExpected a *RuntimeError, got %T: %v", tt.source, err, err)
+			continue
+		}
+		if runtimeErr.Code != tt.code || runtimeErr.Error() != tt.expected {
+			t.Errorf("Source: %s\nExpected: %s %s\nGot: %s %s", tt.source, tt.code, tt.expected, runtimeErr.Code, runtimeErr.Error())
+		}
+	}
+}
+
+func TestVM_RuntimeErrorStack(t *testing.T) {
+	source := `fun inner(x) {
+  return x + nil;
+}
+fun outer() {
+  return inner(1);
+}
+class Box {
+  init() { this.v = outer(); }
+}
+Box();`
+
+	_, err := run(t, source)
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("Expected a *RuntimeError, got %T: %v", err, err)
+	}
+
+	expected := `Traceback (most recent call first):
+  [line 2] in inner()
+  [line 5] in outer()
+  [line 8] in Box()
+  [line 10] in script`
+	if got := interpreter.Traceback(runtimeErr.Stack); got != expected {
+		t.Errorf("Expected traceback:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestVM_RuntimeErrorStackFunctionNamedScript(t *testing.T) {
+	_, err := run(t, "fun script() { return nil + 1; }\nscript();")
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("Expected a *RuntimeError, got %T: %v", err, err)
+	}
+	expected := "Traceback (most recent call first):\n  [line 1] in script()\n  [line 2] in script"
+	if got := interpreter.Traceback(runtimeErr.Stack); got != expected {
+		t.Errorf("Expected traceback:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestVM_KeepsGlobalsAcrossRuns(t *testing.T) {
+	machine := New()
+	var out strings.Builder
+	machine.SetOutput(&out)
+	for _, source := range []string{"var a = 1;", "a = a + 1;", "print a;"} {
+		if err := machine.Interpret(compile(t, source)); err != nil {
+			t.Fatalf("Runtime error: %v", err)
+		}
+	}
+	if out.String() != "2\n" {
+		t.Errorf("Expected 2, got %q", out.String())
+	}
+}
+
+func TestCompile_Limits(t *testing.T) {
+	var locals strings.Builder
+	locals.WriteString("{\n")
+	for i := 0; i < maxLocals; i++ {
+		fmt.Fprintf(&locals, "var v%d;\n", i)
+	}
+	locals.WriteString("}")
+
+	var jump strings.Builder
+	jump.WriteString("if (true) {\n")
+	for i := 0; i < maxJump/2; i++ {
+		jump.WriteString("nil;\n")
+	}
+	jump.WriteString("\n}")
+
+	tests := []struct {
+		name    string
+		source  string
+		code    diagnostics.Code
+		message string
+	}{
+		{"locals", locals.String(), diagnostics.TooManyLocals, "Too many local variables in function."},
+		{"jump", jump.String(), diagnostics.JumpTooLarge, "Too much code to jump over."},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(parse(t, tt.source), nil)
+		var compileErr *CompileError
+		if !errors.As(err, &compileErr) {
+			t.Errorf("%s: expected a *CompileError, got %T: %v", tt.name, err, err)
+			continue
+		}
+		if compileErr.Code != tt.code || compileErr.Message != tt.message {
+			t.Errorf("%s: expected %s %q, got %s %q", tt.name, tt.code, tt.message, compileErr.Code, compileErr.Message)
+		}
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	benchmarkEngines(b, "fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); } fib(20);")
+}
+
+// BenchmarkNumericLoop reports allocations for arithmetic on numbers, which
+// Values store inline instead of boxing on the heap.
+func BenchmarkNumericLoop(b *testing.B) {
+	benchmarkEngines(b, "var sum = 0; for (var i = 0; i < 10000; i = i + 1) { sum = sum + i * 2; }")
+}
+
+// BenchmarkLoopLocals is BenchmarkNumericLoop with a variable declared in
+// the loop body, so each iteration also creates a scope holding a number.
+func BenchmarkLoopLocals(b *testing.B) {
+	benchmarkEngines(b, "var sum = 0; for (var i = 0; i < 10000; i = i + 1) { var x = i * 2; sum = sum + x; }")
+}
+
+// benchmarkEngines runs source on both the tree-walk interpreter and the VM.
+func benchmarkEngines(b *testing.B, source string) {
+	tokens, _ := scanner.ScanTokens(source)
+	statements, ranges, _ := parser.ParseProgramWithRanges(tokens)
+
+	b.Run("tree", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			interp := interpreter.NewInterpreter()
+			resolver.NewResolver(interp).Resolve(statements)
+			if err := interp.Execute(statements); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("vm", func(b *testing.B) {
+		function, err := Compile(statements, ranges)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := New().Interpret(function); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func parse(t *testing.T, source string) []parser.Stmt {
+	t.Helper()
+	statements, _ := parseWithRanges(t, source)
+	return statements
+}
+
+func parseWithRanges(t *testing.T, source string) ([]parser.Stmt, map[parser.Stmt]parser.Range) {
+	t.Helper()
+	tokens, errs := scanner.ScanTokens(source)
+	if len(errs) > 0 {
+		t.Fatalf("Scan errors for source: %s\nErrors: %v", source, errs)
+	}
+	statements, ranges, err := parser.ParseProgramWithRanges(tokens)
+	if err != nil {
+		t.Fatalf("Parse error for source: %s\nError: %v", source, err)
+	}
+	return statements, ranges
+}
+
+// compile resolves and compiles source, failing the test on errors.
+func compile(t *testing.T, source string) *Function {
+	t.Helper()
+	statements, ranges := parseWithRanges(t, source)
+	if err := resolver.NewResolver(nil).Resolve(statements); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+	function, err := Compile(statements, ranges)
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+	return function
+}
+
+// run compiles and runs source on a new VM, returning what it printed.
+func run(t *testing.T, source string) (string, error) {
+	t.Helper()
+	function := compile(t, source)
+	var out strings.Builder
+	machine := New()
+	machine.SetOutput(&out)
+	err := machine.Interpret(function)
+	return out.String(), err
+}